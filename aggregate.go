@@ -0,0 +1,455 @@
+package stored
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// aggregateChunk is max number of rows processed within one transaction, when aggregation
+// is not bound to a transaction large ranges are processed using several transactions
+const aggregateChunk = 10000
+
+// Aggregate is the result of aggregation over objects of the query
+type Aggregate struct {
+	Key   interface{} // value of GroupBy field, nil if query is not grouped
+	Count int64       // number of objects
+	Sum   float64     // sum of field values, numeric fields only
+	Min   interface{} // minimal value of the field
+	Max   interface{} // maximal value of the field
+}
+
+// Avg returns average value of the field
+func (a *Aggregate) Avg() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+func (a *Aggregate) addValue(value interface{}) {
+	v := reflect.ValueOf(value)
+	if v.IsValid() && isNumberKind(v.Kind()) {
+		a.Sum += toFloat64(v)
+	}
+	a.setMinMax(value, value)
+}
+
+func (a *Aggregate) setMinMax(min, max interface{}) {
+	if min != nil {
+		if cmp, ok := compareValues(min, a.Min); a.Min == nil || (ok && cmp < 0) {
+			a.Min = min
+		}
+	}
+	if max != nil {
+		if cmp, ok := compareValues(max, a.Max); a.Max == nil || (ok && cmp > 0) {
+			a.Max = max
+		}
+	}
+}
+
+func (a *Aggregate) merge(other *Aggregate) {
+	a.Count += other.Count
+	a.Sum += other.Sum
+	a.setMinMax(other.Min, other.Max)
+}
+
+// aggregation is set of aggregates by group
+type aggregation struct {
+	groups map[string]*Aggregate
+	resume fdb.Key // key to continue aggregation from within the next transaction
+}
+
+func newAggregation() *aggregation {
+	return &aggregation{groups: map[string]*Aggregate{}}
+}
+
+func (a *aggregation) add(group *Field, key interface{}, field *Field, value interface{}) {
+	id := ""
+	if group != nil {
+		id = string(tuple.Tuple{group.tupleElement(key)}.Pack())
+	}
+	agg, ok := a.groups[id]
+	if !ok {
+		agg = &Aggregate{Key: key}
+		a.groups[id] = agg
+	}
+	agg.Count++
+	if field != nil {
+		agg.addValue(value)
+	}
+}
+
+func (a *aggregation) merge(other *aggregation) {
+	for id, agg := range other.groups {
+		current, ok := a.groups[id]
+		if !ok {
+			a.groups[id] = agg
+			continue
+		}
+		current.merge(agg)
+	}
+}
+
+// total returns aggregate of not grouped query
+func (a *aggregation) total() *Aggregate {
+	agg, ok := a.groups[""]
+	if !ok {
+		return &Aggregate{}
+	}
+	return agg
+}
+
+// list returns groups ordered by key
+func (a *aggregation) list() []Aggregate {
+	ids := make([]string, 0, len(a.groups))
+	for id := range a.groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	res := make([]Aggregate, len(ids))
+	for k, id := range ids {
+		res[k] = *a.groups[id]
+	}
+	return res
+}
+
+// aggregateTask describes aggregation of the query
+type aggregateTask struct {
+	query   *Query
+	group   *Field
+	field   *Field
+	chunked bool    // rows are aggregated within several transactions
+	resume  fdb.Key // where current chunk starts
+}
+
+// run executes the promise, unless the promise is bound to transaction large ranges
+// will be aggregated using several transactions
+func (t *aggregateTask) run(p *Promise) (*aggregation, error) {
+	if p.confirmed {
+		res, _ := p.resp.(*aggregation)
+		return res, p.err
+	}
+	if p.readTr != nil {
+		resp, err := p.transact()
+		if err != nil {
+			return nil, err
+		}
+		return resp.(*aggregation), nil
+	}
+	t.chunked = true
+	t.resume = nil
+	total := newAggregation()
+	for {
+		resp, err := p.transact()
+		p.readTr = nil
+		if err != nil {
+			return nil, err
+		}
+		part := resp.(*aggregation)
+		total.merge(part)
+		if part.resume == nil {
+			break
+		}
+		t.resume = part.resume
+	}
+	p.resp = total
+	p.confirmed = true
+	return total, nil
+}
+
+// needs returns fields which values are necessary to aggregate the row
+func (t *aggregateTask) needs() []*Field {
+	fields := []*Field{}
+	if t.group != nil {
+		fields = append(fields, t.group)
+	}
+	if t.field != nil {
+		fields = append(fields, t.field)
+	}
+	return fields
+}
+
+// covered checks if all necessary values are stored inside keys of the index, so objects
+// will not be fetched
+func (t *aggregateTask) covered(index *Index) bool {
+	if index != nil && (index.search || index.Geo != 0 || index.handle != nil) {
+		return false
+	}
+	for _, field := range t.needs() {
+		if field.primary {
+			continue
+		}
+		if index == nil {
+			return false
+		}
+		found := false
+		for _, indexField := range index.fields {
+			if indexField == field {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *aggregateTask) addValues(part *aggregation, values map[*Field]interface{}) {
+	var key, value interface{}
+	if t.group != nil {
+		key = t.group.fromTupleElement(values[t.group])
+	}
+	if t.field != nil {
+		value = t.field.fromTupleElement(values[t.field])
+	}
+	part.add(t.group, key, t.field, value)
+}
+
+func (t *aggregateTask) addPrimary(part *aggregation, primaryTuple tuple.Tuple, values map[*Field]interface{}) {
+	for k, field := range t.query.object.primaryFields {
+		values[field] = primaryTuple[k]
+	}
+	t.addValues(part, values)
+}
+
+func (t *aggregateTask) addObject(part *aggregation, value *Value) {
+	input := structAny(value.Interface())
+	var key, fieldValue interface{}
+	if t.group != nil {
+		key = input.Get(t.group)
+	}
+	if t.field != nil {
+		fieldValue = input.Get(t.field)
+	}
+	part.add(t.group, key, t.field, fieldValue)
+}
+
+// scan aggregates one chunk of the query
+func (t *aggregateTask) scan(tr fdb.ReadTransaction) (*aggregation, error) {
+	plan := t.query.getPlan()
+	part := newAggregation()
+	limit := 0
+	if t.chunked {
+		limit = aggregateChunk
+	}
+	if len(plan.scans) == 0 {
+		return part, t.scanPrimary(tr, plan, part, limit)
+	}
+	return part, t.scanIndex(tr, plan, part, limit)
+}
+
+func (t *aggregateTask) scanPrimary(tr fdb.ReadTransaction, plan *queryPlan, part *aggregation, limit int) error {
+	o := t.query.object
+	r := t.query.primaryRange()
+	if t.resume != nil {
+		r.Begin = t.resume
+	}
+	if len(plan.residual) == 0 && len(plan.filters) == 0 && t.covered(nil) {
+		return t.scanKeys(tr, r, part, limit)
+	}
+	scanner := o.scanPrimary(tr, r, false)
+	processed := 0
+	for value := scanner.next(); value != nil; value = scanner.next() {
+		if plan.matchResidual(value) {
+			t.addObject(part, value)
+		}
+		processed++
+		if limit != 0 && processed >= limit {
+			part.resume = o.resumeKey(scanner.current, false)
+			break
+		}
+	}
+	return scanner.err
+}
+
+// scanKeys aggregates values taken from primary keys, values of the objects are not decoded
+func (t *aggregateTask) scanKeys(tr fdb.ReadTransaction, r fdb.KeyRange, part *aggregation, limit int) error {
+	o := t.query.object
+	scanner := o.scanKeys(tr, r, false)
+	scanner.stats = t.query.stats
+	processed := 0
+	for primaryTuple := scanner.next(); primaryTuple != nil; primaryTuple = scanner.next() {
+		t.addPrimary(part, primaryTuple, map[*Field]interface{}{})
+		processed++
+		if limit != 0 && processed >= limit {
+			part.resume = o.resumeKey(primaryTuple, false)
+			break
+		}
+	}
+	return scanner.err
+}
+
+func (t *aggregateTask) scanIndex(tr fdb.ReadTransaction, plan *queryPlan, part *aggregation, limit int) error {
+	o := t.query.object
+	// every chunk loads intersected indexes within its own transaction
+	plan, sets, err := plan.intersect(tr, t.query.stats)
+	if err != nil {
+		return err
+	}
+	driving := plan.scans[0]
+	indexOnly := len(plan.residual) == 0 && len(plan.filters) == 0 && t.covered(driving.index)
+
+	batch := []*needObject{}
+	flush := func() error {
+		for _, needed := range batch {
+			value, err := needed.fetch()
+			if err == ErrNotFound { // index is outdated
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if plan.matchResidual(value) {
+				t.addObject(part, value)
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+	processed := 0
+	for _, r := range driving.ranges {
+		r, ok := resumeRange(r, t.resume, false)
+		if !ok {
+			continue
+		}
+		iterator := tr.GetRange(r, fdb.RangeOptions{Mode: fdb.StreamingModeIterator}).Iterator()
+		for iterator.Advance() {
+			kv, err := iterator.Get()
+			if err != nil {
+				return err
+			}
+			primaryTuple, err := driving.primary(kv)
+			if err != nil {
+				return err
+			}
+			packed := string(primaryTuple.Pack())
+			intersected := true
+			for _, set := range sets {
+				if !set[packed] {
+					intersected = false
+					break
+				}
+			}
+			if intersected {
+				if indexOnly {
+					keyTuple, err := driving.index.dir.Unpack(kv.Key)
+					if err != nil {
+						return err
+					}
+					values := map[*Field]interface{}{}
+					for k, field := range driving.index.fields {
+						if k < len(keyTuple) {
+							values[field] = keyTuple[k]
+						}
+					}
+					t.addPrimary(part, primaryTuple, values)
+				} else {
+					batch = append(batch, o.need(tr, o.sub(primaryTuple)))
+					if len(batch) >= 100 {
+						err = flush()
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+			processed++
+			if limit != 0 && processed >= limit {
+				part.resume = kv.Key
+				return flush()
+			}
+		}
+	}
+	return flush()
+}
+
+// aggregate sets up the promise aggregating query objects
+func (q *Query) aggregate(p *Promise, group *Field, fieldName string) *aggregateTask {
+	task := aggregateTask{
+		query: q,
+		group: group,
+	}
+	if fieldName != "" {
+		task.field = q.object.field(fieldName)
+	}
+	p.db = q.object.db
+	p.doRead(func() Chain {
+		part, err := task.scan(p.readTr)
+		if err != nil {
+			return p.fail(err)
+		}
+		return p.done(part)
+	})
+	return &task
+}
+
+func (q *Query) aggregateValue(fieldName string, pick func(a *Aggregate) interface{}) *PromiseAggregate {
+	p := &PromiseAggregate{pick: pick}
+	p.task = q.aggregate(&p.Promise, nil, fieldName)
+	return p
+}
+
+// Count returns number of objects matching the query, Limit is not applied
+func (q *Query) Count() *PromiseAggregate {
+	return q.aggregateValue("", func(a *Aggregate) interface{} {
+		return a.Count
+	})
+}
+
+// Sum returns sum of numeric field values of objects matching the query
+func (q *Query) Sum(fieldName string) *PromiseAggregate {
+	return q.aggregateValue(fieldName, func(a *Aggregate) interface{} {
+		return a.Sum
+	})
+}
+
+// Min returns minimal value of the field, use Scan to get the value
+func (q *Query) Min(fieldName string) *PromiseAggregate {
+	return q.aggregateValue(fieldName, func(a *Aggregate) interface{} {
+		return a.Min
+	})
+}
+
+// Max returns maximal value of the field, use Scan to get the value
+func (q *Query) Max(fieldName string) *PromiseAggregate {
+	return q.aggregateValue(fieldName, func(a *Aggregate) interface{} {
+		return a.Max
+	})
+}
+
+// Avg returns average value of numeric field
+func (q *Query) Avg(fieldName string) *PromiseAggregate {
+	return q.aggregateValue(fieldName, func(a *Aggregate) interface{} {
+		return a.Avg()
+	})
+}
+
+// GroupQuery is the query aggregating objects by values of the field
+type GroupQuery struct {
+	query *Query
+	group *Field
+}
+
+// GroupBy groups objects of the query by field values
+func (q *Query) GroupBy(fieldName string) *GroupQuery {
+	return &GroupQuery{
+		query: q,
+		group: q.object.field(fieldName),
+	}
+}
+
+// Count returns number of objects inside each group
+func (g *GroupQuery) Count() *PromiseGroups {
+	return g.Aggregate("")
+}
+
+// Aggregate returns count, sum, min and max of the field inside each group
+func (g *GroupQuery) Aggregate(fieldName string) *PromiseGroups {
+	p := &PromiseGroups{}
+	p.task = g.query.aggregate(&p.Promise, g.group, fieldName)
+	return p
+}
@@ -0,0 +1,244 @@
+package stored
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// BulkOption is the option struct of BulkAdd and BulkDelete
+type BulkOption struct {
+	// MaxBytes is the approximate size of data written within one transaction, 1MB by default
+	MaxBytes int
+	// MaxKeys is the approximate number of keys written within one transaction, 10000 by default
+	MaxKeys int
+	// Workers is the number of transactions executed concurrently, 4 by default
+	Workers int
+}
+
+// BulkError describes failed item of a bulk operation
+type BulkError struct {
+	Index int // index of the item inside passed slice
+	Err   error
+}
+
+func (e BulkError) Error() string {
+	return fmt.Sprintf("item %d: %s", e.Index, e.Err)
+}
+
+func bulkOption(options []BulkOption) BulkOption {
+	option := BulkOption{MaxBytes: 1000000, MaxKeys: 10000, Workers: 4}
+	for _, opt := range options {
+		if opt.MaxBytes > 0 {
+			option.MaxBytes = opt.MaxBytes
+		}
+		if opt.MaxKeys > 0 {
+			option.MaxKeys = opt.MaxKeys
+		}
+		if opt.Workers > 0 {
+			option.Workers = opt.Workers
+		}
+	}
+	return option
+}
+
+// bulkSlice returns reflect value of the slice, pointer to slice is also accepted
+func (o *Object) bulkSlice(slice interface{}) (reflect.Value, error) {
+	value := reflect.ValueOf(slice)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Slice {
+		return value, fmt.Errorf("bulk operation of «%s» requires slice, got %T", o.name, slice)
+	}
+	return value, nil
+}
+
+// BulkAdd adds all objects of the slice using several concurrent transactions. Objects are packed into
+// transactions by size and number of keys. Autoincrement ids are reserved for the whole slice at once and
+// set to the objects, so slice should contain pointers or be addressable. If transaction of a batch fails
+// objects of the batch are added one by one, errors of failed objects are returned
+func (o *Object) BulkAdd(slice interface{}, options ...BulkOption) ([]BulkError, error) {
+	option := bulkOption(options)
+	list, err := o.bulkSlice(slice)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*Struct, list.Len())
+	for k := range items {
+		item := list.Index(k)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		items[k] = structEditable(item.Interface())
+	}
+	err = o.bulkGenerateIDs(items)
+	if err != nil {
+		return nil, err
+	}
+	batches := bulkSplit(len(items), option, func(k int) (int, int) {
+		return o.writeSize(items[k])
+	})
+	return o.bulkRun(batches, option, func(k int) *Promise {
+		input := items[k]
+		p := o.promiseErr()
+		p.do(func() Chain {
+			return o.insert(p.self(), input)
+		})
+		return p.self()
+	}), nil
+}
+
+// BulkDelete removes objects by ids or objects with primary set using several concurrent transactions.
+// If transaction of a batch fails objects of the batch are removed one by one, errors of failed
+// objects are returned
+func (o *Object) BulkDelete(ids interface{}, options ...BulkOption) ([]BulkError, error) {
+	option := bulkOption(options)
+	list, err := o.bulkSlice(ids)
+	if err != nil {
+		return nil, err
+	}
+	keys := 1 + len(o.indexes) + len(o.counters)
+	batches := bulkSplit(list.Len(), option, func(k int) (int, int) {
+		primaryLen := len(o.primary.Pack(o.getPrimaryTuple(list.Index(k).Interface())))
+		return keys * primaryLen * 2, keys
+	})
+	return o.bulkRun(batches, option, func(k int) *Promise {
+		return o.Delete(list.Index(k).Interface()).self()
+	}), nil
+}
+
+// bulkGenerateIDs sets autoincrement and generated ids of all the objects
+func (o *Object) bulkGenerateIDs(items []*Struct) error {
+	if len(items) == 0 {
+		return nil
+	}
+	for _, field := range o.getFields() {
+		if field.AutoIncrement {
+			last, err := o.reserveIDs(field, len(items))
+			if err != nil {
+				return err
+			}
+			first := last - int64(len(items)) + 1
+			for k, input := range items {
+				objField := checkNilPtrObject(input.value.Field(field.Num))
+				if isUintKind(objField.Kind()) {
+					objField.SetUint(uint64(first + int64(k)))
+				} else {
+					objField.SetInt(first + int64(k))
+				}
+			}
+		} else if field.GenID != 0 {
+			for _, input := range items {
+				input.value.Field(field.Num).SetInt(field.GenerateID())
+			}
+		}
+	}
+	return nil
+}
+
+// reserveIDs increments autoincrement counter of the field by n and returns the last reserved id
+func (o *Object) reserveIDs(field *Field, n int) (int64, error) {
+	incKey := o.miscDir.Pack(tuple.Tuple{"ai", field.Name})
+	res, err := o.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		buf := make([]byte, 8)
+		binary.LittleEndian.PutUint64(buf, uint64(n))
+		tr.Add(incKey, buf[:len(GetPlus(field.Kind))])
+		return tr.Get(incKey).Get()
+	})
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 8)
+	copy(buf, res.([]byte))
+	return int64(binary.LittleEndian.Uint64(buf)), nil
+}
+
+// writeSize estimates number of bytes and keys written by doWrite for the new object
+func (o *Object) writeSize(input *Struct) (int, int) {
+	primaryLen := len(o.primary.Pack(input.getPrimary(o)))
+	size, keys := 0, 0
+	for _, field := range o.mutableFields {
+		if field.UnStored || field.primary {
+			continue
+		}
+		size += primaryLen + len(field.Name) + len(input.GetMutableFieldBytes(field))
+		keys++
+	}
+	if len(o.immutableFields) > 0 {
+		packedFields, _ := o.packFields(input)
+		size += primaryLen + len(packedFields)
+		keys++
+	}
+	others := len(o.indexes) + len(o.counters)
+	return size + others*primaryLen*2, keys + others
+}
+
+// bulkSplit splits items into batches limited by bytes and keys
+func bulkSplit(count int, option BulkOption, size func(k int) (int, int)) [][]int {
+	batches := [][]int{}
+	batch := []int{}
+	batchBytes, batchKeys := 0, 0
+	for k := 0; k < count; k++ {
+		bytes, keys := size(k)
+		if len(batch) > 0 && (batchBytes+bytes > option.MaxBytes || batchKeys+keys > option.MaxKeys) {
+			batches = append(batches, batch)
+			batch = []int{}
+			batchBytes, batchKeys = 0, 0
+		}
+		batch = append(batch, k)
+		batchBytes += bytes
+		batchKeys += keys
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// bulkRun executes batches by workers, every batch within one transaction. Promise should create the new
+// promise for the item each call, so failed batch could be retried item by item
+func (o *Object) bulkRun(batches [][]int, option BulkOption, promise func(k int) *Promise) []BulkError {
+	queue := make(chan []int, len(batches))
+	for _, batch := range batches {
+		queue <- batch
+	}
+	close(queue)
+
+	errs := []BulkError{}
+	var mux sync.Mutex
+	var wait sync.WaitGroup
+	for w := 0; w < option.Workers; w++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for batch := range queue {
+				t := Transaction{db: o.db}
+				for _, k := range batch {
+					t.tasks = append(t.tasks, transactionTask{promise: promise(k), check: true})
+				}
+				if t.Err() == nil {
+					continue
+				}
+				for _, k := range batch {
+					err := promise(k).Err()
+					if err != nil {
+						mux.Lock()
+						errs = append(errs, BulkError{Index: k, Err: err})
+						mux.Unlock()
+					}
+				}
+			}
+		}()
+	}
+	wait.Wait()
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Index < errs[j].Index
+	})
+	return errs
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+)
+
+// maxDiffCells limits the table of common subsequence lengths, changed blocks larger than that are
+// reported as whole removed and added
+const maxDiffCells = 1 << 20
+
+// lineDiff returns lines removed from old prefixed by "-" and lines added in new prefixed by "+"
+func lineDiff(old, new string) string {
+	a := strings.SplitAfter(old, "\n")
+	b := strings.SplitAfter(new, "\n")
+	// generated code usually changes in one place, common lines around it are not compared
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	var diff strings.Builder
+	line := func(sign, text string) {
+		diff.WriteString(sign + strings.TrimSuffix(text, "\n") + "\n")
+	}
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, text := range a {
+			line("-", text)
+		}
+		for _, text := range b {
+			line("+", text)
+		}
+		return diff.String()
+	}
+	// lcs[i][j] is the length of common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			line("-", a[i])
+			i++
+		default:
+			line("+", b[j])
+			j++
+		}
+	}
+	return diff.String()
+}
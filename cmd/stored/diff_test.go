@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	diff := lineDiff("a\nb\nc\nd\n", "a\nx\nc\nd\ne\n")
+	if diff != "-b\n+x\n+e\n" {
+		t.Fatalf("unexpected diff %q", diff)
+	}
+
+	// large files with one changed line are compared without the quadratic table
+	lines := strings.Repeat("line\n", 100000)
+	diff = lineDiff(lines+"old\n"+lines, lines+"new\n"+lines)
+	if diff != "-old\n+new\n" {
+		t.Fatalf("unexpected diff of large files %q", diff)
+	}
+
+	// changed block over the table limit is reported as replaced
+	old := strings.Repeat("a\n", 2000)
+	diff = lineDiff(old, strings.Repeat("b\n", 2000))
+	if diff != strings.Repeat("-a\n", 2000)+strings.Repeat("+b\n", 2000) {
+		t.Fatal("unexpected diff of large changed block")
+	}
+}
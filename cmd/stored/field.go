@@ -2,6 +2,9 @@ package main
 
 import (
 	"go/ast"
+	"go/token"
+	"strings"
+	"unicode"
 )
 
 // Field describes field of object in the ast
@@ -16,9 +19,39 @@ type Field struct {
 }
 
 func (f *Field) generateEncode() string {
-	return `value := ` + f.object.shortForm + `.` + f.name + `
-		` + f.fieldType.generateEncode()
-	//return `[]byte{}`
+	return `case "` + f.tagName + `":
+		` + f.fieldType.generateEncode(f.object.shortForm+`.`+f.name)
+}
+
+func (f *Field) generateDecode() string {
+	return `case "` + f.tagName + `":
+		` + f.fieldType.generateDecode(f.object.shortForm+`.`+f.name)
+}
+
+// hasOption checks if stored tag has the option
+func (f *Field) hasOption(option string) bool {
+	for _, opt := range f.Options {
+		if strings.TrimSpace(opt) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// paramName returns name of the field suitable for a function parameter, ChatID becomes chatID
+func (f *Field) paramName() string {
+	upper := 0
+	for upper < len(f.name) && unicode.IsUpper(rune(f.name[upper])) {
+		upper++
+	}
+	if upper > 1 && upper < len(f.name) {
+		upper-- // last capital letter starts the next word
+	}
+	name := strings.ToLower(f.name[:upper]) + f.name[upper:]
+	if token.IsKeyword(name) || name == "s" || name == "obj" || name == "list" || name == "err" {
+		name += "Value"
+	}
+	return name
 }
 
 func (f *Field) parseType(expr ast.Expr) {
@@ -28,13 +28,23 @@ func (f *File) parseComments() {
 			if !strings.Contains(commands[1], "stored") {
 				continue
 			}
-			comm.End()
-			//f.ast.
-			f.pack.gen.setPosition(f, int(comm.End()-f.ast.Pos()))
+			f.pack.gen.setPosition(f, f.codePosition(comm))
 		}
 	}
 }
 
+// codePosition returns offset generated code is placed at, it is right after the comment
+// unless imports follow the comment
+func (f *File) codePosition(comm *ast.Comment) int {
+	pos := comm.End()
+	for _, decl := range f.ast.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok && genDecl.Tok == token.IMPORT && genDecl.End() > pos {
+			pos = genDecl.End()
+		}
+	}
+	return f.fileSet.Position(pos).Offset
+}
+
 func (f *File) parseNode(node ast.Node) bool {
 	switch x := node.(type) {
 	case *ast.Comment:
@@ -78,7 +88,12 @@ func (f *File) parseObjects() {
 							structType: structType,
 						}
 						obj.parse()
-						f.pack.objects[obj.name] = obj
+						if ts.Doc != nil {
+							obj.parseDoc(ts.Doc)
+						} else if len(genDecl.Specs) == 1 {
+							obj.parseDoc(genDecl.Doc)
+						}
+						f.pack.objects[obj.name] = &obj
 					}
 				}
 			}
@@ -116,7 +131,6 @@ func (f *File) parseFuncs() {
 			obj, ok := f.pack.objects[objectName]
 			if ok {
 				obj.shortForm = sourceName
-				f.pack.objects[objectName] = obj
 			}
 		}
 	}
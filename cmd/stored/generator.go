@@ -1,20 +1,31 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
 	"io/ioutil"
-	"log"
+	"os"
+	"sort"
 	"strings"
 )
 
 const prefix = `// Code generated by STORED DO NOT EDIT.`
 const postfix = `// End of STORED generated code`
+const msgpackPath = "github.com/vmihailenco/msgpack/v5"
+const storedPath = "github.com/sflabsorg/stored"
 
 // Generator used collected info to generate stored code
 type Generator struct {
-	file *File
-	pos  int
+	file     *File
+	pos      int
+	imports  string // import declarations generated code requires
+	check    bool   // only compare generated code with existing one
+	separate bool   // write generated code into separate *_stored.go file
 }
 
 func (g *Generator) setPosition(file *File, pos int) {
@@ -33,6 +44,9 @@ func (g *Generator) cutOldCode(code string) (string, error) {
 		if cutEnd == -1 {
 			return code, errors.New("old code closing tag «" + postfix + "» not found")
 		}
+		if cutEnd < cutStart {
+			return code, errors.New("old code closing tag «" + postfix + "» found before the opening one")
+		}
 		cutEnd += len(postfix)
 		if len(code) > cutEnd {
 			cutEnd++
@@ -46,52 +60,185 @@ func (g *Generator) cutOldCode(code string) (string, error) {
 		}
 
 	}
+	if strings.Contains(code, postfix) {
+		return code, errors.New("old code closing tag «" + postfix + "» found without the opening one")
+	}
 	return code, nil
 }
 
-func (g *Generator) write(src string) {
-	if g.file == nil {
-		fmt.Printf("no generate tag found, please put this tag in your code //go:generate $GOPATH/bin/stored")
-		return
+// importName returns name the package is imported with, import declaration is added if the file
+// does not import the package
+func (g *Generator) importName(path, name string) string {
+	for _, spec := range g.file.ast.Imports {
+		if g.separate {
+			break // imports of separate file are independent
+		}
+		if strings.Trim(spec.Path.Value, "`\"") != path {
+			continue
+		}
+		if spec.Name != nil {
+			return spec.Name.Name
+		}
+		return name
 	}
+	decl := "\n\nimport " + name + " \"" + path + "\""
+	if !strings.Contains(g.imports, decl) {
+		g.imports += decl
+	}
+	return name
+}
+
+// separateName returns name of the file generated code is written to in separate mode
+func (g *Generator) separateName() string {
+	return strings.TrimSuffix(g.file.name, ".go") + "_stored.go"
+}
+
+// splice inserts generated code into the file with //go:generate tag, old generated code is removed
+func (g *Generator) splice(src string) ([]byte, error) {
 	codeBytes, err := ioutil.ReadFile(g.file.name)
 	if err != nil {
-		fmt.Printf("could not read file «%s»: %v", g.file.name, err)
-		return
+		return nil, fmt.Errorf("could not read file «%s»: %v", g.file.name, err)
 	}
-	code := string(codeBytes)
-	code, err = g.cutOldCode(code)
+	code, err := g.cutOldCode(string(codeBytes))
 	if err != nil {
-		fmt.Println("new code ERRR", err)
-		fmt.Printf("%s", err)
-		return
+		return nil, err
+	}
+	if src == "" {
+		// imports added for the spliced code are not needed anymore
+		code = removeUnusedImport(code, "msgpack", msgpackPath)
+		code = removeUnusedImport(code, "stored", storedPath)
+		return []byte(code), nil
 	}
 
+	if imp := g.imports; imp != "" {
+		// import is placed right after the package clause
+		importPos := g.file.fileSet.Position(g.file.ast.Name.End()).Offset
+		if g.pos < importPos {
+			return nil, errors.New("//go:generate tag should be placed after the package clause")
+		}
+		code = code[:importPos] + imp + code[importPos:]
+		g.pos += len(imp)
+	}
 	code = code[0:g.pos] + src + code[g.pos:]
-	//lines := bytes.Split(b, []byte{'\n'})
 
-	err = ioutil.WriteFile(g.file.name, []byte(code), 0644)
+	formatted, err := format.Source([]byte(code))
 	if err != nil {
-		log.Fatalf("writing output: %s", err)
+		return nil, fmt.Errorf("generated code of «%s» is invalid: %s", g.file.name, err)
 	}
+	return formatted, nil
 }
 
-func (g *Generator) generateUtil() string {
-	return `
-func _stored_vInt(writer io.Writer, v int) error {
-	var _stored_vInt_buf = make([]byte, 8)
-	l := binary.PutUvarint(_stored_vInt_buf, uint64(v))
-	_, err := writer.Write(_stored_vInt_buf[:l])
-	return err
-}`
+// removeUnusedImport removes import declaration added by the generator if the package is not used
+func removeUnusedImport(code, name, path string) string {
+	decl := "\n\nimport " + name + " \"" + path + "\""
+	if !strings.Contains(code, decl) {
+		return code
+	}
+	removed := strings.Replace(code, decl, "", 1)
+	file, err := parser.ParseFile(token.NewFileSet(), "", removed, 0)
+	if err != nil {
+		return code
+	}
+	used := false
+	ast.Inspect(file, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Name == name {
+				used = true
+			}
+		}
+		return !used
+	})
+	if used {
+		return code
+	}
+	return removed
 }
 
-// generate triggers code generation
-func (g *Generator) generate(blocks []string) {
-	src := "\n\n" + prefix + "\n/*" + g.generateUtil()
+// render returns new content of files affected by generation, nil content means file should be removed
+func (g *Generator) render(blocks []string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	src := ""
 	for _, block := range blocks {
-		src += "\n" + block
+		src += block
 	}
-	src += "*/\n" + postfix
-	g.write(src)
+	if !g.separate {
+		spliced, err := g.splice("\n\n" + prefix + "\n" + src + postfix)
+		if err != nil {
+			return nil, err
+		}
+		files[g.file.name] = spliced
+		files[g.separateName()] = nil
+		return files, nil
+	}
+	// old code spliced into the source is removed
+	source, err := g.splice("")
+	if err != nil {
+		return nil, err
+	}
+	files[g.file.name] = source
+	code := prefix + "\n\npackage " + g.file.ast.Name.Name + g.imports + "\n" + src
+	formatted, err := format.Source([]byte(code))
+	if err != nil {
+		return nil, fmt.Errorf("generated code of «%s» is invalid: %s", g.separateName(), err)
+	}
+	files[g.separateName()] = formatted
+	return files, nil
+}
+
+// readOld returns current content of the file, nil if file does not exist
+func readOld(name string) ([]byte, error) {
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// write saves generated files, in check mode files are only compared and false is returned if any is stale
+func (g *Generator) write(blocks []string) (bool, error) {
+	if g.file == nil {
+		return false, errors.New("no generate tag found, please put this tag in your code //go:generate $GOPATH/bin/stored")
+	}
+	files, err := g.render(blocks)
+	if err != nil {
+		return false, err
+	}
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fresh := true
+	for _, name := range names {
+		old, err := readOld(name)
+		if err != nil {
+			return false, err
+		}
+		data := files[name]
+		if data == nil && old != nil && !bytes.HasPrefix(old, []byte(prefix)) {
+			continue // file was not generated by STORED, keep it
+		}
+		if bytes.Equal(old, data) {
+			continue
+		}
+		if g.check {
+			fresh = false
+			fmt.Printf("--- %s\n+++ %s (generated)\n%s", name, name, lineDiff(string(old), string(data)))
+			continue
+		}
+		if data == nil {
+			err = os.Remove(name)
+		} else {
+			err = ioutil.WriteFile(name, data, 0644)
+		}
+		if err != nil {
+			return false, fmt.Errorf("writing output: %s", err)
+		}
+	}
+	return fresh, nil
+}
+
+// generate triggers code generation
+func (g *Generator) generate(blocks []string) (bool, error) {
+	return g.write(blocks)
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sflabsorg/stored/cmd/stored/internal/sample"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// TestGenerateGolden renders internal/sample in check mode, generated code checked in there should
+// be exactly what the generator produces
+func TestGenerateGolden(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir("internal/sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pack := Package{}
+	pack.init()
+	pack.gen.check = true
+	pack.parse("./", nil)
+	fresh, err := pack.generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fresh {
+		t.Fatal("generated code differs from internal/sample/sample.go, run go generate there and review the diff")
+	}
+}
+
+// TestGenerateBadRelation checks relation to unknown object is reported as an error
+func TestGenerateBadRelation(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	source := "package bad\n\n//go:generate stored\n\n// Member has relation to unknown object\n//stored:n2n Missing\ntype Member struct {\n\tID int64 `stored:\"id,primary\"`\n}\n"
+	err = os.WriteFile(dir+"/bad.go", []byte(source), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pack := Package{}
+	pack.init()
+	pack.gen.check = true
+	pack.parse("./", nil)
+	_, err = pack.generate()
+	if err == nil || !strings.Contains(err.Error(), "Missing") {
+		t.Fatalf("relation to unknown object should fail generation, got %v", err)
+	}
+}
+
+// TestGeneratedRoundTrip encodes every field with generated code and decodes it back
+func TestGeneratedRoundTrip(t *testing.T) {
+	input := sample.Account{
+		ID:      -7,
+		Login:   "gen",
+		Country: "fr",
+		Balance: math.MinInt32 - 1,
+		Level:   -3,
+		Rank:    -2,
+		Points:  7,
+		Flags:   512,
+		Score:   1.5,
+		Rating:  4.25,
+		Active:  true,
+		Avatar:  []byte{1, 2, 3},
+	}
+	names := []string{"id", "login", "country", "balance", "level", "rank", "points", "flags", "score", "rating", "active", "avatar"}
+	output := sample.Account{}
+	for _, name := range names {
+		var buf bytes.Buffer
+		ok, err := input.StoredEncodeField(name, msgpack.NewEncoder(&buf))
+		if !ok || err != nil {
+			t.Fatalf("encoding «%s»: %v %v", name, ok, err)
+		}
+		ok, err = output.StoredDecodeField(name, msgpack.NewDecoder(&buf))
+		if !ok || err != nil {
+			t.Fatalf("decoding «%s»: %v %v", name, ok, err)
+		}
+	}
+	if !reflect.DeepEqual(input, output) {
+		t.Fatalf("round trip changed the object: %+v, expected %+v", output, input)
+	}
+
+	// generated code should be interchangeable with reflection encoding of msgpack
+	var buf bytes.Buffer
+	_, err := input.StoredEncodeField("balance", msgpack.NewEncoder(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var balance int
+	err = msgpack.Unmarshal(buf.Bytes(), &balance)
+	if err != nil || balance != input.Balance {
+		t.Fatalf("reflection decoded balance %d (%v), expected %d", balance, err, input.Balance)
+	}
+
+	// stored encodes values with msgpack.Marshal, generated bytes of small integers should be the same
+	small := map[string]interface{}{"level": input.Level, "rank": input.Rank, "points": input.Points}
+	for name, value := range small {
+		var generated bytes.Buffer
+		_, err = input.StoredEncodeField(name, msgpack.NewEncoder(&generated))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reflected, err := msgpack.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(generated.Bytes(), reflected) {
+			t.Fatalf("generated «%s» is %x, reflection encodes %x", name, generated.Bytes(), reflected)
+		}
+	}
+
+	ok, err := output.StoredEncodeField("-", msgpack.NewEncoder(&buf))
+	if ok || err != nil {
+		t.Fatalf("unknown field should not be encoded, got %v %v", ok, err)
+	}
+}
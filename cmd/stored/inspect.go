@@ -0,0 +1,626 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const inspectUsage = `usage: stored inspect [-cluster file] [-limit n] command [args]
+
+commands:
+  dirs                                  list directories
+  objects   DIR                         list objects and relations of the directory
+  scheme    DIR OBJECT                  print scheme versions of the object
+  get       DIR OBJECT PRIMARY...       print object by primary key
+  scan      DIR OBJECT INDEX [VALUE...] print index entries starting with the values
+  count     DIR OBJECT                  count objects
+  relation  DIR HOST CLIENT [NAME] [HOST_PRIMARY...]
+                                        print relation edges, of one host if primary passed
+  counters  DIR OBJECT                  print counters of the object
+`
+
+// codecMarker starts packed fields written by non default codec, followed by scheme version
+const codecMarker = 0xc1
+
+// inspectScheme mirrors scheme version stored by the layer
+type inspectScheme struct {
+	PrimaryFields []inspectField `json:"primary"`
+	PackedFields  []inspectField `json:"packed"`
+	MutableFields []inspectField `json:"mutable"`
+	Indexes       []struct {
+		Name   string `json:"name"`
+		Unique bool   `json:"unique,omitempty"`
+	} `json:"indexes"`
+	Codec   string `json:"codec,omitempty"`
+	Created int64  `json:"timestamp"`
+}
+
+type inspectField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Inspector reads data of STORED layer using the key layout, no object types are needed
+type Inspector struct {
+	db    fdb.Database
+	out   io.Writer
+	limit int
+}
+
+// inspect runs inspect command and returns exit code
+func inspect(args []string) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	cluster := flags.String("cluster", "", "path to the cluster file, default one is used if empty")
+	limit := flags.Int("limit", 100, "max number of printed rows")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, inspectUsage)
+		flags.PrintDefaults()
+	}
+	if flags.Parse(args) != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	err := fdb.APIVersion(630)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	db, err := fdb.OpenDatabase(*cluster)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	in := Inspector{db: db, out: os.Stdout, limit: *limit}
+	err = in.run(flags.Arg(0), flags.Args()[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func (in *Inspector) run(command string, args []string) error {
+	need := func(n int) error {
+		if len(args) < n {
+			return fmt.Errorf("%s requires %d arguments, see stored inspect -h", command, n)
+		}
+		return nil
+	}
+	switch command {
+	case "dirs":
+		return in.dirs()
+	case "objects":
+		if err := need(1); err != nil {
+			return err
+		}
+		return in.objects(args[0])
+	case "scheme":
+		if err := need(2); err != nil {
+			return err
+		}
+		return in.scheme(args[0], args[1])
+	case "get":
+		if err := need(3); err != nil {
+			return err
+		}
+		return in.get(args[0], args[1], args[2:])
+	case "scan":
+		if err := need(3); err != nil {
+			return err
+		}
+		return in.scan(args[0], args[1], args[2], args[3:])
+	case "count":
+		if err := need(2); err != nil {
+			return err
+		}
+		return in.count(args[0], args[1])
+	case "relation":
+		if err := need(3); err != nil {
+			return err
+		}
+		return in.relation(args[0], args[1], args[2], args[3:])
+	case "counters":
+		if err := need(2); err != nil {
+			return err
+		}
+		return in.counters(args[0], args[1])
+	}
+	return errors.New("unknown command «" + command + "»")
+}
+
+func (in *Inspector) print(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(in.out, string(data))
+	return err
+}
+
+func (in *Inspector) open(path ...string) (directory.DirectorySubspace, error) {
+	dir, err := directory.Open(in.db, path, nil)
+	if err == directory.ErrDirNotExists {
+		return nil, errors.New("directory «" + strings.Join(path, "/") + "» not found")
+	}
+	return dir, err
+}
+
+func (in *Inspector) list(path ...string) ([]string, error) {
+	names, err := directory.List(in.db, path)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (in *Inspector) dirs() error {
+	names, err := in.list()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprintln(in.out, name)
+	}
+	return nil
+}
+
+func (in *Inspector) objects(dirName string) error {
+	names, err := in.list(dirName)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name == "rel" {
+			continue
+		}
+		fmt.Fprintln(in.out, "object", name)
+	}
+	hosts, err := in.list(dirName, "rel")
+	if err != nil {
+		return nil // no relations declared
+	}
+	for _, host := range hosts {
+		clients, err := in.list(dirName, "rel", host)
+		if err != nil {
+			return err
+		}
+		for _, client := range clients {
+			fmt.Fprintln(in.out, "relation", host, client)
+			names, err := in.list(dirName, "rel", host, client)
+			if err != nil {
+				return err
+			}
+			for _, name := range names {
+				if name != "host" && name != "client" {
+					fmt.Fprintln(in.out, "relation", host, client, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// versions loads all scheme versions of the object
+func (in *Inspector) versions(dirName, objectName string) (map[int64]inspectScheme, int64, error) {
+	misc, err := in.open(dirName, objectName, "misc")
+	if err != nil {
+		return nil, 0, err
+	}
+	sub := misc.Sub("scheme")
+	res, err := in.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		return tr.GetRange(sub, fdb.RangeOptions{}).GetSliceWithError()
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	versions := map[int64]inspectScheme{}
+	latest := int64(0)
+	for _, kv := range res.([]fdb.KeyValue) {
+		key, err := sub.Unpack(kv.Key)
+		if err != nil {
+			return nil, 0, err
+		}
+		version, ok := key[0].(int64)
+		if !ok {
+			return nil, 0, errors.New("scheme version key is corrupted")
+		}
+		scheme := inspectScheme{}
+		err = json.Unmarshal(kv.Value, &scheme)
+		if err != nil {
+			return nil, 0, err
+		}
+		versions[version] = scheme
+		if version > latest {
+			latest = version
+		}
+	}
+	if latest == 0 {
+		return nil, 0, errors.New("object «" + objectName + "» has no scheme")
+	}
+	return versions, latest, nil
+}
+
+func (in *Inspector) latest(dirName, objectName string) (inspectScheme, error) {
+	versions, latest, err := in.versions(dirName, objectName)
+	if err != nil {
+		return inspectScheme{}, err
+	}
+	return versions[latest], nil
+}
+
+func (in *Inspector) scheme(dirName, objectName string) error {
+	versions, _, err := in.versions(dirName, objectName)
+	if err != nil {
+		return err
+	}
+	numbers := []int64{}
+	for version := range versions {
+		numbers = append(numbers, version)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	for _, version := range numbers {
+		err = in.print(map[string]interface{}{"version": version, "scheme": versions[version]})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// primaryDir opens subspace of objects, it is named by primary fields
+func (in *Inspector) primaryDir(dirName, objectName string, scheme inspectScheme) (directory.DirectorySubspace, error) {
+	path := []string{dirName, objectName}
+	for _, field := range scheme.PrimaryFields {
+		path = append(path, field.Name)
+	}
+	return in.open(path...)
+}
+
+// parseElement converts command line value to tuple element using type of the field
+func parseElement(value, fieldType string) (tuple.TupleElement, error) {
+	switch {
+	case strings.HasPrefix(fieldType, "int"):
+		return strconv.ParseInt(value, 10, 64)
+	case strings.HasPrefix(fieldType, "uint"):
+		n, err := strconv.ParseUint(value, 10, 64)
+		return int64(n), err
+	case strings.HasPrefix(fieldType, "float"):
+		return strconv.ParseFloat(value, 64)
+	case fieldType == "bool":
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+func parseTuple(values []string, fields []inspectField) (tuple.Tuple, error) {
+	if len(values) > len(fields) {
+		return nil, fmt.Errorf("%d values passed for %d fields", len(values), len(fields))
+	}
+	res := tuple.Tuple{}
+	for k, value := range values {
+		el, err := parseElement(value, fields[k].Type)
+		if err != nil {
+			return nil, fmt.Errorf("field «%s»: %s", fields[k].Name, err)
+		}
+		res = append(res, el)
+	}
+	return res, nil
+}
+
+// decodeField decodes value of the field key, integer mutable fields could be stored as little-endian
+func decodeField(data []byte, field inspectField) interface{} {
+	if len(data) == 8 && (strings.HasPrefix(field.Type, "int") || strings.HasPrefix(field.Type, "uint")) {
+		return int64(binary.LittleEndian.Uint64(data))
+	}
+	var value interface{}
+	err := msgpack.Unmarshal(data, &value)
+	if err != nil {
+		return fmt.Sprintf("undecodable %x", data)
+	}
+	return value
+}
+
+// decodePacked decodes packed fields written by msgpack or JSON codec, body of custom codecs is returned as is
+func decodePacked(data []byte) (map[string]interface{}, error) {
+	packed := map[string]interface{}{}
+	if len(data) == 0 || data[0] != codecMarker {
+		err := msgpack.Unmarshal(data, &packed)
+		return packed, err
+	}
+	_, n := binary.Uvarint(data[1:])
+	if n <= 0 {
+		return nil, errors.New("invalid codec header")
+	}
+	body := data[1+n:]
+	if json.Unmarshal(body, &packed) != nil {
+		return map[string]interface{}{"*": fmt.Sprintf("encoded %x", body)}, nil
+	}
+	return packed, nil
+}
+
+// decodeObject converts keys of one object into map of fields
+func decodeObject(primary tuple.Tuple, rows []fdb.KeyValue, sub subspace.Subspace, scheme inspectScheme) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	for k, field := range scheme.PrimaryFields {
+		res[field.Name] = primary[k]
+	}
+	mutable := map[string]inspectField{}
+	for _, field := range scheme.MutableFields {
+		mutable[field.Name] = field
+	}
+	for _, kv := range rows {
+		key, err := sub.Unpack(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			continue // empty object key
+		}
+		name, _ := key[0].(string)
+		if name == "*" {
+			packed, err := decodePacked(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			for fieldName, value := range packed {
+				res[fieldName] = value
+			}
+			continue
+		}
+		res[name] = decodeField(kv.Value, mutable[name])
+	}
+	return res, nil
+}
+
+func (in *Inspector) get(dirName, objectName string, values []string) error {
+	scheme, err := in.latest(dirName, objectName)
+	if err != nil {
+		return err
+	}
+	primaryDir, err := in.primaryDir(dirName, objectName, scheme)
+	if err != nil {
+		return err
+	}
+	if len(values) != len(scheme.PrimaryFields) {
+		return fmt.Errorf("primary key has %d fields", len(scheme.PrimaryFields))
+	}
+	primary, err := parseTuple(values, scheme.PrimaryFields)
+	if err != nil {
+		return err
+	}
+	sub := primaryDir.Sub(primary...)
+	res, err := in.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		return tr.GetRange(sub, fdb.RangeOptions{}).GetSliceWithError()
+	})
+	if err != nil {
+		return err
+	}
+	rows := res.([]fdb.KeyValue)
+	if len(rows) == 0 {
+		return errors.New("object not found")
+	}
+	object, err := decodeObject(primary, rows, sub, scheme)
+	if err != nil {
+		return err
+	}
+	return in.print(object)
+}
+
+func (in *Inspector) scan(dirName, objectName, indexName string, values []string) error {
+	scheme, err := in.latest(dirName, objectName)
+	if err != nil {
+		return err
+	}
+	unique, found := false, false
+	for _, index := range scheme.Indexes {
+		if index.Name == indexName {
+			unique, found = index.Unique, true
+		}
+	}
+	if !found {
+		return errors.New("index «" + indexName + "» not found")
+	}
+	fields := []inspectField{}
+	all := append(append(append([]inspectField{}, scheme.PrimaryFields...), scheme.PackedFields...), scheme.MutableFields...)
+	for _, name := range strings.Split(indexName, ",") {
+		field := inspectField{Name: name, Type: "string"}
+		for _, f := range all {
+			if f.Name == name {
+				field = f
+			}
+		}
+		fields = append(fields, field)
+	}
+	prefix, err := parseTuple(values, fields)
+	if err != nil {
+		return err
+	}
+	indexDir, err := in.open(dirName, objectName, indexName)
+	if err != nil {
+		return err
+	}
+	sub := indexDir.Sub(prefix...)
+	res, err := in.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		return tr.GetRange(sub, fdb.RangeOptions{Limit: in.limit}).GetSliceWithError()
+	})
+	if err != nil {
+		return err
+	}
+	for _, kv := range res.([]fdb.KeyValue) {
+		key, err := indexDir.Unpack(kv.Key)
+		if err != nil {
+			return err
+		}
+		var primary tuple.Tuple
+		if unique {
+			primary, err = tuple.Unpack(kv.Value)
+			if err != nil {
+				return err
+			}
+		} else if len(key) >= len(scheme.PrimaryFields) {
+			split := len(key) - len(scheme.PrimaryFields)
+			key, primary = key[:split], key[split:]
+		}
+		err = in.print(map[string]interface{}{"key": key, "primary": primary})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (in *Inspector) count(dirName, objectName string) error {
+	scheme, err := in.latest(dirName, objectName)
+	if err != nil {
+		return err
+	}
+	primaryDir, err := in.primaryDir(dirName, objectName, scheme)
+	if err != nil {
+		return err
+	}
+	keyLen := len(scheme.PrimaryFields)
+	begin, end := primaryDir.FDBRangeKeys()
+	keyRange := fdb.KeyRange{Begin: begin, End: end}
+	count := 0
+	var last tuple.Tuple
+	for {
+		res, err := in.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+			return tr.GetRange(keyRange, fdb.RangeOptions{Limit: 10000}).GetSliceWithError()
+		})
+		if err != nil {
+			return err
+		}
+		rows := res.([]fdb.KeyValue)
+		for _, kv := range rows {
+			key, err := primaryDir.Unpack(kv.Key)
+			if err != nil {
+				return err
+			}
+			if len(key) < keyLen {
+				return errors.New("primary key is corrupted")
+			}
+			primary := key[:keyLen]
+			if last == nil || string(primary.Pack()) != string(last.Pack()) {
+				count++
+				last = primary
+			}
+		}
+		if len(rows) < 10000 {
+			break
+		}
+		keyRange.Begin = fdb.Key(append(rows[len(rows)-1].Key, 0x00))
+	}
+	fmt.Fprintln(in.out, count)
+	return nil
+}
+
+func (in *Inspector) relation(dirName, host, client string, args []string) error {
+	path := []string{dirName, "rel", host, client}
+	if len(args) > 0 {
+		if names, err := in.list(append(path, args[0])...); err == nil && len(names) > 0 {
+			path = append(path, args[0])
+			args = args[1:]
+		}
+	}
+	hostScheme, err := in.latest(dirName, host)
+	if err != nil {
+		return err
+	}
+	clientScheme, err := in.latest(dirName, client)
+	if err != nil {
+		return err
+	}
+	hostDir, err := in.open(append(path, "host")...)
+	if err != nil {
+		return err
+	}
+	hostPrimary, err := parseTuple(args, hostScheme.PrimaryFields)
+	if err != nil {
+		return err
+	}
+	info, err := in.open(path...)
+	if err != nil {
+		return err
+	}
+	sub := hostDir.Sub(hostPrimary...)
+	res, err := in.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		return tr.GetRange(sub, fdb.RangeOptions{Limit: in.limit}).GetSliceWithError()
+	})
+	if err != nil {
+		return err
+	}
+	hostLen := len(hostScheme.PrimaryFields)
+	for _, kv := range res.([]fdb.KeyValue) {
+		key, err := hostDir.Unpack(kv.Key)
+		if err != nil {
+			return err
+		}
+		if len(key) != hostLen+len(clientScheme.PrimaryFields) {
+			return errors.New("relation key is corrupted")
+		}
+		edge := map[string]interface{}{"host": key[:hostLen], "client": key[hostLen:]}
+		if len(kv.Value) > 0 {
+			edge["client_data"] = decodeField(kv.Value, inspectField{})
+		}
+		err = in.print(edge)
+		if err != nil {
+			return err
+		}
+	}
+	if len(hostPrimary) == hostLen {
+		res, err := in.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+			return tr.Get(info.Sub("a").Pack(hostPrimary)).Get()
+		})
+		if err == nil && res.([]byte) != nil {
+			fmt.Fprintln(in.out, "clients count", decodeField(res.([]byte), inspectField{Type: "int64"}))
+		}
+	}
+	return nil
+}
+
+func (in *Inspector) counters(dirName, objectName string) error {
+	counterDir, err := in.open(dirName, objectName, "counter")
+	if err != nil {
+		return err
+	}
+	res, err := in.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		return tr.GetRange(counterDir, fdb.RangeOptions{Limit: in.limit}).GetSliceWithError()
+	})
+	if err != nil {
+		return err
+	}
+	for _, kv := range res.([]fdb.KeyValue) {
+		key, err := counterDir.Unpack(kv.Key)
+		if err != nil {
+			return err
+		}
+		var count int64
+		err = msgpack.Unmarshal(kv.Value, &count)
+		if err != nil {
+			return err
+		}
+		err = in.print(map[string]interface{}{"key": key, "count": count})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
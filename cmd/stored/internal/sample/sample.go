@@ -0,0 +1,153 @@
+// Package sample is the golden output of the generator, generator tests check the code below is
+// exactly what cmd/stored renders for this file
+package sample
+
+import stored "github.com/sflabsorg/stored"
+
+import msgpack "github.com/vmihailenco/msgpack/v5"
+
+//go:generate stored
+
+// Code generated by STORED DO NOT EDIT.
+
+// StoredDB contains typed accessors of stored objects and relations
+type StoredDB struct {
+	Account AccountStored
+}
+
+// AccountStored is typed accessor of Account objects
+type AccountStored struct {
+	*stored.Object
+}
+
+// GetByID fetches Account by primary key
+func (s AccountStored) GetByID(id int64) (*Account, error) {
+	obj := Account{ID: id}
+	err := s.Object.Get(&obj).Err()
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// GetByLogin fetches Account using unique index «login»
+func (s AccountStored) GetByLogin(login string) (*Account, error) {
+	obj := Account{Login: login}
+	err := s.Object.GetBy(&obj, "login").Err()
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// ListByCountry fetches list of Account using index «country»
+func (s AccountStored) ListByCountry(country string) ([]Account, error) {
+	list := []Account{}
+	err := s.Object.Use("country").List(country).ScanAll(&list)
+	return list, err
+}
+
+// StoredEncodeField encodes field of Account without reflection
+func (a *Account) StoredEncodeField(name string, enc *msgpack.Encoder) (bool, error) {
+	switch name {
+	case "id":
+		return true, enc.EncodeInt64(a.ID)
+	case "login":
+		return true, enc.EncodeString(a.Login)
+	case "country":
+		return true, enc.EncodeString(a.Country)
+	case "balance":
+		return true, enc.EncodeInt(int64(a.Balance))
+	case "level":
+		return true, enc.EncodeInt8(a.Level)
+	case "rank":
+		return true, enc.EncodeInt16(a.Rank)
+	case "points":
+		return true, enc.EncodeInt32(a.Points)
+	case "flags":
+		return true, enc.EncodeUint16(a.Flags)
+	case "score":
+		return true, enc.EncodeFloat32(a.Score)
+	case "rating":
+		return true, enc.EncodeFloat64(a.Rating)
+	case "active":
+		return true, enc.EncodeBool(a.Active)
+	case "avatar":
+		return true, enc.EncodeBytes(a.Avatar)
+	}
+	return false, nil
+}
+
+// StoredDecodeField decodes field of Account without reflection
+func (a *Account) StoredDecodeField(name string, dec *msgpack.Decoder) (bool, error) {
+	switch name {
+	case "id":
+		v, err := dec.DecodeInt64()
+		a.ID = v
+		return true, err
+	case "login":
+		v, err := dec.DecodeString()
+		a.Login = v
+		return true, err
+	case "country":
+		v, err := dec.DecodeString()
+		a.Country = v
+		return true, err
+	case "balance":
+		v, err := dec.DecodeInt64()
+		a.Balance = int(v)
+		return true, err
+	case "level":
+		v, err := dec.DecodeInt64()
+		a.Level = int8(v)
+		return true, err
+	case "rank":
+		v, err := dec.DecodeInt64()
+		a.Rank = int16(v)
+		return true, err
+	case "points":
+		v, err := dec.DecodeInt64()
+		a.Points = int32(v)
+		return true, err
+	case "flags":
+		v, err := dec.DecodeUint64()
+		a.Flags = uint16(v)
+		return true, err
+	case "score":
+		v, err := dec.DecodeFloat32()
+		a.Score = v
+		return true, err
+	case "rating":
+		v, err := dec.DecodeFloat64()
+		a.Rating = v
+		return true, err
+	case "active":
+		v, err := dec.DecodeBool()
+		a.Active = v
+		return true, err
+	case "avatar":
+		v, err := dec.DecodeBytes()
+		a.Avatar = v
+		return true, err
+	}
+	return false, nil
+}
+
+// End of STORED generated code
+
+// Account is sample object with fields of every type the generator encodes
+type Account struct {
+	ID      int64   `stored:"id,primary"`
+	Login   string  `stored:"login,unique"`
+	Country string  `stored:"country,index"`
+	Balance int     `stored:"balance,mutable"`
+	Level   int8    `stored:"level"`
+	Rank    int16   `stored:"rank"`
+	Points  int32   `stored:"points"`
+	Flags   uint16  `stored:"flags"`
+	Score   float32 `stored:"score"`
+	Rating  float64 `stored:"rating"`
+	Active  bool    `stored:"active"`
+	Avatar  []byte  `stored:"avatar"`
+	Note    string  `stored:"-"`
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"go/ast"
-	"strconv"
 	"strings"
 
 	"github.com/fatih/structtag"
@@ -15,6 +14,20 @@ type Object struct {
 	file       *File
 	structType *ast.StructType
 	fields     []*Field
+	relations  []string // clients of N2N relations declared by //stored:n2n comment
+}
+
+// parseDoc reads stored directives of the struct comment
+func (o *Object) parseDoc(doc *ast.CommentGroup) {
+	if doc == nil {
+		return
+	}
+	for _, comm := range doc.List {
+		words := strings.Fields(strings.TrimPrefix(comm.Text, "//"))
+		if len(words) == 2 && words[0] == "stored:n2n" {
+			o.relations = append(o.relations, words[1])
+		}
+	}
 }
 
 func (o *Object) parse() {
@@ -65,26 +78,124 @@ func (o *Object) fieldParse(name string, tag string, fieldNum int) (Field, error
 	return field, nil
 }
 
-func (o *Object) genMain() string {
-	return "type " + o.name + "Stored {}\n"
+// genMain returns typed accessor of the object with methods for primary and indexed fields
+func (o *Object) genMain(g *Generator) string {
+	pkg := g.importName(storedPath, "stored")
+	src := `
+// ` + o.name + `Stored is typed accessor of ` + o.name + ` objects
+type ` + o.name + `Stored struct {
+	*` + pkg + `.Object
+}
+`
+	primary := []*Field{}
+	for _, field := range o.fields {
+		if field.hasOption("primary") {
+			primary = append(primary, field)
+		}
+	}
+	for _, field := range o.fields {
+		if !field.fieldType.local() || field.tagName == "" || field.tagName == "-" {
+			continue
+		}
+		param := field.paramName() + " " + field.fieldType.expr
+		switch {
+		case field.hasOption("primary") && len(primary) == 1:
+			src += `
+// GetBy` + field.name + ` fetches ` + o.name + ` by primary key
+func (s ` + o.name + `Stored) GetBy` + field.name + `(` + param + `) (*` + o.name + `, error) {
+	obj := ` + o.name + `{` + field.name + `: ` + field.paramName() + `}
+	err := s.Object.Get(&obj).Err()
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+`
+		case field.hasOption("unique"):
+			src += `
+// GetBy` + field.name + ` fetches ` + o.name + ` using unique index «` + field.tagName + `»
+func (s ` + o.name + `Stored) GetBy` + field.name + `(` + param + `) (*` + o.name + `, error) {
+	obj := ` + o.name + `{` + field.name + `: ` + field.paramName() + `}
+	err := s.Object.GetBy(&obj, "` + field.tagName + `").Err()
+	if err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+`
+		case field.hasOption("index"):
+			src += `
+// ListBy` + field.name + ` fetches list of ` + o.name + ` using index «` + field.tagName + `»
+func (s ` + o.name + `Stored) ListBy` + field.name + `(` + param + `) ([]` + o.name + `, error) {
+	list := []` + o.name + `{}
+	err := s.Object.Use("` + field.tagName + `").List(` + field.paramName() + `).ScanAll(&list)
+	return list, err
+}
+`
+		}
+	}
+	return src
+}
+
+// genRelation returns typed accessor of N2N relation with the client
+func (o *Object) genRelation(g *Generator, client *Object) string {
+	pkg := g.importName(storedPath, "stored")
+	name := o.name + client.name + "Stored"
+	return `
+// ` + name + ` is typed accessor of N2N relation between ` + o.name + ` and ` + client.name + `
+type ` + name + ` struct {
+	*` + pkg + `.Relation
+}
+
+// Link connects ` + o.name + ` with ` + client.name + `
+func (s ` + name + `) Link(host *` + o.name + `, client *` + client.name + `) error {
+	return s.Relation.Add(host, client).Err()
 }
 
-func (o *Object) generate() string {
+// Clients fetches ` + client.name + ` objects connected with ` + o.name + `
+func (s ` + name + `) Clients(host *` + o.name + `) ([]` + client.name + `, error) {
+	list := []` + client.name + `{}
+	err := s.Relation.GetClients(host, nil).ScanAll(&list)
+	return list, err
+}
+
+// Hosts fetches ` + o.name + ` objects connected with ` + client.name + `
+func (s ` + name + `) Hosts(client *` + client.name + `) ([]` + o.name + `, error) {
+	list := []` + o.name + `{}
+	err := s.Relation.GetHosts(client, nil).ScanAll(&list)
+	return list, err
+}
+`
+}
+
+// generate returns methods encoding and decoding fields
+func (o *Object) generate(g *Generator) string {
 	fieldsEncode := ""
+	fieldsDecode := ""
 	for _, field := range o.fields {
-		fieldsEncode += `case ` + strconv.Itoa(field.num) + `:
-		` + field.generateEncode() + `
-	`
+		if !field.fieldType.supported() || field.tagName == "" || field.tagName == "-" {
+			continue
+		}
+		fieldsEncode += "\t" + field.generateEncode() + "\n"
+		fieldsDecode += "\t" + field.generateDecode() + "\n"
 	}
-	fieldsEncode += `default:
-		panic(errors.New("unknown field encoded"))`
-	mainObject := o.genMain()
-	return "\n\n" + mainObject + `
-func (` + o.shortForm + ` *` + o.name + `) _encodeField(num int, writer io.Writer) (err error) {
-	switch(num) {
-	` + fieldsEncode + `
+	if fieldsEncode == "" {
+		return ""
 	}
-	return errors.New("unknown field number")
+	pkg := g.importName(msgpackPath, "msgpack")
+	return `
+// StoredEncodeField encodes field of ` + o.name + ` without reflection
+func (` + o.shortForm + ` *` + o.name + `) StoredEncodeField(name string, enc *` + pkg + `.Encoder) (bool, error) {
+	switch name {
+` + fieldsEncode + `	}
+	return false, nil
+}
+
+// StoredDecodeField decodes field of ` + o.name + ` without reflection
+func (` + o.shortForm + ` *` + o.name + `) StoredDecodeField(name string, dec *` + pkg + `.Decoder) (bool, error) {
+	switch name {
+` + fieldsDecode + `	}
+	return false, nil
 }
 `
 }
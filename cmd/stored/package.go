@@ -1,21 +1,23 @@
 package main
 
 import (
+	"fmt"
 	"go/build"
 	"go/parser"
 	"go/token"
 	"log"
+	"sort"
 )
 
 // Package will return
 type Package struct {
 	files   []File
-	objects map[string]Object
+	objects map[string]*Object
 	gen     Generator
 }
 
 func (p *Package) init() {
-	p.objects = map[string]Object{}
+	p.objects = map[string]*Object{}
 	p.files = []File{}
 	p.gen = Generator{}
 }
@@ -46,21 +48,58 @@ func (p *Package) parse(directory string, text interface{}) {
 	}
 }
 
-func (p *Package) genTopObject() string { // generates top level object with all instances of database
-	objs := ""
-	for _, obj := range p.objects {
-		objs += "	" + obj.name + " " + obj.name + "Stored\n"
+// genTopObject generates top level object with typed accessors of all the objects and relations
+func (p *Package) genTopObject(objects []*Object) (string, error) {
+	fields := ""
+	blocks := ""
+	for _, obj := range objects {
+		fields += "\t" + obj.name + " " + obj.name + "Stored\n"
+		blocks += obj.genMain(&p.gen)
 	}
-	return "var db StoredDB = StoredDB{}\ntype StoredDB struct {\n" + objs + "}"
+	for _, obj := range objects {
+		for _, clientName := range obj.relations {
+			client, ok := p.objects[clientName]
+			if !ok || len(client.fields) == 0 {
+				return "", fmt.Errorf("relation client «%s» of «%s» is not a stored object", clientName, obj.name)
+			}
+			fields += "\t" + obj.name + client.name + " " + obj.name + client.name + "Stored\n"
+			blocks += obj.genRelation(&p.gen, client)
+		}
+	}
+	return `
+// StoredDB contains typed accessors of stored objects and relations
+type StoredDB struct {
+` + fields + `}
+` + blocks, nil
 }
 
-func (p *Package) generate() {
-	blocks := []string{}
-	blocks = append(blocks, p.genTopObject())
-	for _, obj := range p.objects {
+// generate writes generated code, false is returned in check mode if the code is stale
+func (p *Package) generate() (bool, error) {
+	if p.gen.file == nil {
+		return p.gen.generate(nil)
+	}
+	names := []string{}
+	for name := range p.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	objects := []*Object{}
+	for _, name := range names {
+		obj := p.objects[name]
 		if len(obj.fields) > 0 {
-			blocks = append(blocks, obj.generate())
+			objects = append(objects, obj)
 		}
 	}
-	p.gen.generate(blocks)
+	if len(objects) == 0 {
+		return p.gen.generate(nil)
+	}
+	top, err := p.genTopObject(objects)
+	if err != nil {
+		return false, err
+	}
+	blocks := []string{top}
+	for _, obj := range objects {
+		blocks = append(blocks, obj.generate(&p.gen))
+	}
+	return p.gen.generate(blocks)
 }
@@ -1,8 +1,31 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		os.Exit(inspect(os.Args[2:]))
+	}
+	check := flag.Bool("check", false, "do not write files, exit with non-zero code if generated code is stale")
+	separate := flag.Bool("separate", false, "write generated code into separate *_stored.go file")
+	flag.Parse()
+
 	pack := Package{}
 	pack.init()
+	pack.gen.check = *check
+	pack.gen.separate = *separate
 	pack.parse("./", nil)
-	pack.generate()
+	fresh, err := pack.generate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "stored:", err)
+		os.Exit(2)
+	}
+	if !fresh {
+		fmt.Fprintln(os.Stderr, "stored: generated code is stale, run go generate")
+		os.Exit(1)
+	}
 }
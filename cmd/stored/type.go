@@ -0,0 +1,101 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// FieldType describes type of the field, only types encoded without reflection are recognized
+type FieldType struct {
+	name string // go name of the type, empty if type is not supported
+	expr string // type as written in the source
+}
+
+// encodeMethods maps go type to msgpack encoder method and the type method accepts. Methods are the same
+// msgpack uses for reflection without UseCompactInts, as stored encodes values with msgpack.Marshal, so
+// sized integers keep their fixed width and generated bytes are equal to reflection ones
+var encodeMethods = map[string][2]string{
+	"string":  {"EncodeString", "string"},
+	"bool":    {"EncodeBool", "bool"},
+	"int":     {"EncodeInt", "int64"},
+	"int8":    {"EncodeInt8", "int8"},
+	"int16":   {"EncodeInt16", "int16"},
+	"int32":   {"EncodeInt32", "int32"},
+	"int64":   {"EncodeInt64", "int64"},
+	"uint":    {"EncodeUint", "uint64"},
+	"uint8":   {"EncodeUint8", "uint8"},
+	"uint16":  {"EncodeUint16", "uint16"},
+	"uint32":  {"EncodeUint32", "uint32"},
+	"uint64":  {"EncodeUint64", "uint64"},
+	"float32": {"EncodeFloat32", "float32"},
+	"float64": {"EncodeFloat64", "float64"},
+	"[]byte":  {"EncodeBytes", "[]byte"},
+}
+
+// decodeMethods maps go type to msgpack decoder method and the type method returns
+var decodeMethods = map[string][2]string{
+	"string":  {"DecodeString", "string"},
+	"bool":    {"DecodeBool", "bool"},
+	"int":     {"DecodeInt64", "int64"},
+	"int8":    {"DecodeInt64", "int64"},
+	"int16":   {"DecodeInt64", "int64"},
+	"int32":   {"DecodeInt64", "int64"},
+	"int64":   {"DecodeInt64", "int64"},
+	"uint":    {"DecodeUint64", "uint64"},
+	"uint8":   {"DecodeUint64", "uint64"},
+	"uint16":  {"DecodeUint64", "uint64"},
+	"uint32":  {"DecodeUint64", "uint64"},
+	"uint64":  {"DecodeUint64", "uint64"},
+	"float32": {"DecodeFloat32", "float32"},
+	"float64": {"DecodeFloat64", "float64"},
+	"[]byte":  {"DecodeBytes", "[]byte"},
+}
+
+func (t *FieldType) parse(expr ast.Expr) {
+	t.expr = types.ExprString(expr)
+	name := ""
+	switch x := expr.(type) {
+	case *ast.Ident:
+		name = x.Name
+	case *ast.ArrayType:
+		if elt, ok := x.Elt.(*ast.Ident); ok && x.Len == nil && elt.Name == "byte" {
+			name = "[]byte"
+		}
+	}
+	if _, ok := encodeMethods[name]; ok {
+		t.name = name
+	}
+}
+
+// supported reports whether generated code could encode the type
+func (t *FieldType) supported() bool {
+	return t.name != ""
+}
+
+// local reports whether the type could be used by generated code, types of other packages could be
+// imported under different names in the file with generated code
+func (t *FieldType) local() bool {
+	return !strings.Contains(t.expr, ".")
+}
+
+// generateEncode returns code encoding value variable with enc
+func (t *FieldType) generateEncode(value string) string {
+	method := encodeMethods[t.name]
+	if method[1] != t.name {
+		value = method[1] + "(" + value + ")"
+	}
+	return `return true, enc.` + method[0] + `(` + value + `)`
+}
+
+// generateDecode returns code decoding dec into target
+func (t *FieldType) generateDecode(target string) string {
+	value := "v"
+	method := decodeMethods[t.name]
+	if method[1] != t.name {
+		value = t.name + "(v)"
+	}
+	return `v, err := dec.` + method[0] + `()
+		` + target + ` = ` + value + `
+		return true, err`
+}
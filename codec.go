@@ -0,0 +1,227 @@
+package stored
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes packed immutable fields of the object. Custom codecs (protobuf for example) receive pointer
+// to the whole object, only immutable fields are taken from the decoded object
+type Codec interface {
+	Name() string // stored inside the scheme, so rows written by previous codec stay readable
+	Marshal(objectPtr interface{}) ([]byte, error)
+	Unmarshal(data []byte, objectPtr interface{}) error
+}
+
+// fieldsCodec is implemented by built-in codecs, which encode immutable fields as map by stored names
+type fieldsCodec interface {
+	encodeFields(o *Object, value reflect.Value) ([]byte, error)
+	decodeFields(o *Object, value reflect.Value, data []byte, fields map[string]bool) error
+}
+
+// MsgpackCodec is the default codec, rows are stored without codec header
+var MsgpackCodec Codec = msgpackCodec{}
+
+// JSONCodec stores packed fields as JSON object
+var JSONCodec Codec = jsonCodec{}
+
+// codecMarker starts rows encoded by non default codecs, followed by scheme version of the row.
+// Msgpack never uses this byte
+const codecMarker = 0xc1
+
+var codecsMux sync.Mutex
+var codecs = map[string]Codec{
+	MsgpackCodec.Name(): MsgpackCodec,
+	JSONCodec.Name():    JSONCodec,
+}
+
+// RegisterCodec makes custom codec known by its name. Codecs passed to ObjectBuilder.Codec are registered
+// automatically, codecs the directory migrated from should be registered to read old rows
+func RegisterCodec(codec Codec) {
+	codecsMux.Lock()
+	codecs[codec.Name()] = codec
+	codecsMux.Unlock()
+}
+
+func codecByName(name string) Codec {
+	codecsMux.Lock()
+	defer codecsMux.Unlock()
+	return codecs[name]
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(objectPtr interface{}) ([]byte, error) {
+	return msgpack.Marshal(objectPtr)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, objectPtr interface{}) error {
+	return msgpack.Unmarshal(data, objectPtr)
+}
+
+func (msgpackCodec) encodeFields(o *Object, value reflect.Value) ([]byte, error) {
+	return (&Struct{value: value}).GetImmutableFieldsBytes(o.immutableFields)
+}
+
+func (msgpackCodec) decodeFields(o *Object, value reflect.Value, data []byte, fields map[string]bool) error {
+	return fillObjectImmutableFields(o, value, data, fields)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(objectPtr interface{}) ([]byte, error) {
+	return json.Marshal(objectPtr)
+}
+
+func (jsonCodec) Unmarshal(data []byte, objectPtr interface{}) error {
+	return json.Unmarshal(data, objectPtr)
+}
+
+func (jsonCodec) encodeFields(o *Object, value reflect.Value) ([]byte, error) {
+	combinedFields := map[string]interface{}{}
+	for fieldName, field := range o.immutableFields {
+		packed, err := field.packValue(value.Field(field.Num))
+		if err != nil {
+			return nil, err
+		}
+		combinedFields[fieldName] = packed
+	}
+	return json.Marshal(combinedFields)
+}
+
+func (jsonCodec) decodeFields(o *Object, value reflect.Value, data []byte, fields map[string]bool) error {
+	combinedFields := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &combinedFields)
+	if err != nil {
+		return err
+	}
+	for fieldName, raw := range combinedFields {
+		field, ok := o.immutableFields[fieldName]
+		if !ok || (fields != nil && !fields[fieldName]) {
+			continue
+		}
+		fieldValue, err := field.decodeJSON(raw)
+		if err != nil {
+			return fmt.Errorf("field «%s»: %w", fieldName, err)
+		}
+		value.Field(field.Num).Set(fieldValue)
+	}
+	return nil
+}
+
+// decodeJSON decodes field value encoded by JSONCodec
+func (f *Field) decodeJSON(raw json.RawMessage) (reflect.Value, error) {
+	if f.nullable() {
+		if string(raw) == "null" {
+			return reflect.Zero(f.Type.Type), nil
+		}
+		value, err := f.elem.decodeJSON(raw)
+		if err != nil {
+			return value, err
+		}
+		return f.wrap(value), nil
+	}
+	if f.codec.custom() {
+		var data []byte
+		err := json.Unmarshal(raw, &data)
+		if err != nil {
+			return reflect.Zero(f.Type.Type), err
+		}
+		return f.decodeCustom(data)
+	}
+	ptr := reflect.New(f.Type.Type)
+	err := json.Unmarshal(raw, ptr.Interface())
+	return ptr.Elem(), err
+}
+
+// defaultCodec checks if packed fields are stored as msgpack without codec header
+func (o *Object) defaultCodec() bool {
+	return o.codec == nil || o.codec == MsgpackCodec
+}
+
+// packFields encodes immutable fields of the input with the codec of the object
+func (o *Object) packFields(input *Struct) ([]byte, error) {
+	if len(o.immutableFields) == 0 {
+		return nil, nil
+	}
+	if o.defaultCodec() {
+		return input.GetImmutableFieldsBytes(o.immutableFields)
+	}
+	var data []byte
+	var err error
+	if codec, ok := o.codec.(fieldsCodec); ok {
+		data, err = codec.encodeFields(o, input.value)
+	} else {
+		ptr := reflect.New(o.reflectType)
+		ptr.Elem().Set(input.value)
+		data, err = o.codec.Marshal(ptr.Interface())
+	}
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 1+binary.MaxVarintLen64)
+	header[0] = codecMarker
+	n := binary.PutUvarint(header[1:], o.schemeVersion)
+	return append(header[:1+n], data...), nil
+}
+
+// unpackFields decodes packed immutable fields written by any codec the object had
+func (o *Object) unpackFields(value reflect.Value, data []byte, fields map[string]bool) error {
+	if len(data) == 0 || data[0] != codecMarker {
+		return fillObjectImmutableFields(o, value, data, fields)
+	}
+	version, n := binary.Uvarint(data[1:])
+	if n <= 0 {
+		return ErrDataCorrupt
+	}
+	data = data[1+n:]
+	codec := o.codecs[version]
+	if codec == nil {
+		if version <= o.schemeVersion {
+			return fmt.Errorf("codec of scheme version %d is not registered", version)
+		}
+		codec = o.codec // row is written by newer scheme, stored by other instance
+	}
+	if codec, ok := codec.(fieldsCodec); ok {
+		return codec.decodeFields(o, value, data, fields)
+	}
+	decoded := reflect.New(o.reflectType)
+	err := codec.Unmarshal(data, decoded.Interface())
+	if err != nil {
+		return err
+	}
+	for fieldName, field := range o.immutableFields {
+		if fields == nil || fields[fieldName] {
+			value.Field(field.Num).Set(decoded.Elem().Field(field.Num))
+		}
+	}
+	return nil
+}
+
+// plainPacked checks if packed fields could be edited as msgpack map without decoding into the object
+func (o *Object) plainPacked(data []byte) bool {
+	return o.defaultCodec() && (len(data) == 0 || data[0] != codecMarker)
+}
+
+// editPacked decodes packed fields into the object, applies the edit and encodes them with current codec
+func (o *Object) editPacked(data []byte, edit func(value reflect.Value) error) ([]byte, error) {
+	value := reflect.New(o.reflectType).Elem()
+	err := o.unpackFields(value, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = edit(value)
+	if err != nil {
+		return nil, err
+	}
+	return o.packFields(&Struct{value: value})
+}
@@ -0,0 +1,256 @@
+package stored
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Operator is comparison operator used inside declarative conditions
+type Operator int
+
+const (
+	// Eq matches when field is equal to the value
+	Eq Operator = iota + 1
+	// Ne matches when field is not equal to the value
+	Ne
+	// Gt matches when field is greater than the value
+	Gt
+	// Gte matches when field is greater than or equal to the value
+	Gte
+	// Lt matches when field is less than the value
+	Lt
+	// Lte matches when field is less than or equal to the value
+	Lte
+	// In matches when field is equal to one of the values, value should be a slice
+	In
+)
+
+var operatorNames = map[Operator]string{
+	Eq:  "eq",
+	Ne:  "ne",
+	Gt:  "gt",
+	Gte: "gte",
+	Lt:  "lt",
+	Lte: "lte",
+	In:  "in",
+}
+
+// String returns short name of the operator, used to store conditions inside the scheme
+func (op Operator) String() string {
+	name, ok := operatorNames[op]
+	if !ok {
+		return "unknown"
+	}
+	return name
+}
+
+// condition is declarative check of one field of an object
+type condition struct {
+	field *Field
+	op    Operator
+	value interface{}
+}
+
+func newCondition(o *Object, fieldName string, op Operator, value interface{}) condition {
+	if _, ok := operatorNames[op]; !ok {
+		o.panic("unknown operator for field «" + fieldName + "»")
+	}
+	if op == In && reflect.ValueOf(value).Kind() != reflect.Slice {
+		o.panic("In operator for field «" + fieldName + "» requires slice of values")
+	}
+	field := o.field(fieldName)
+	if field.nullable() && op != In {
+		if field.isNull(value) {
+			value = nil
+		} else {
+			value = field.unwrap(value)
+		}
+	}
+	return condition{
+		field: field,
+		op:    op,
+		value: value,
+	}
+}
+
+// match checks the condition against field value of the input
+func (c *condition) match(input *Struct) bool {
+	return c.matchValue(input.Get(c.field))
+}
+
+func (c *condition) matchValue(fieldValue interface{}) bool {
+	if c.field.nullable() {
+		if c.field.isNull(fieldValue) {
+			fieldValue = nil // null equals only to nil
+		} else {
+			fieldValue = c.field.unwrap(fieldValue)
+		}
+	}
+	if c.op == In {
+		list := reflect.ValueOf(c.value)
+		for k := 0; k < list.Len(); k++ {
+			eq := condition{field: c.field, op: Eq, value: list.Index(k).Interface()}
+			if eq.matchValue(fieldValue) {
+				return true
+			}
+		}
+		return false
+	}
+	cmp, ok := compareValues(fieldValue, c.value)
+	if !ok {
+		// values of different kinds could be checked only for equality
+		equal := reflect.DeepEqual(fieldValue, c.value)
+		switch c.op {
+		case Eq:
+			return equal
+		case Ne:
+			return !equal
+		}
+		return false
+	}
+	switch c.op {
+	case Eq:
+		return cmp == 0
+	case Ne:
+		return cmp != 0
+	case Gt:
+		return cmp > 0
+	case Gte:
+		return cmp >= 0
+	case Lt:
+		return cmp < 0
+	case Lte:
+		return cmp <= 0
+	}
+	return false
+}
+
+// String returns readable condition, used to explain queries
+func (c *condition) String() string {
+	return c.field.Name + " " + c.op.String() + " " + fmt.Sprint(c.value)
+}
+
+// values returns list of values condition compares with
+func (c *condition) values() []interface{} {
+	if c.op != In {
+		return []interface{}{c.value}
+	}
+	list := reflect.ValueOf(c.value)
+	res := make([]interface{}, list.Len())
+	for k := range res {
+		res[k] = list.Index(k).Interface()
+	}
+	return res
+}
+
+// equal checks that conditions are identical
+func (c *condition) equal(other *condition) bool {
+	return c.field == other.field && c.op == other.op && reflect.DeepEqual(c.value, other.value)
+}
+
+// compareValues compares two values of comparable kinds, numbers of different types are compared
+// as numbers. Returns false if values could not be compared
+func compareValues(a, b interface{}) (int, bool) {
+	av := reflect.ValueOf(a)
+	bv := reflect.ValueOf(b)
+	if !av.IsValid() || !bv.IsValid() {
+		return 0, false
+	}
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case at.Before(bt):
+			return -1, true
+		case at.After(bt):
+			return 1, true
+		}
+		return 0, true
+	}
+	switch {
+	case isIntKind(av.Kind()) && isIntKind(bv.Kind()):
+		return compareInt64(av.Int(), bv.Int()), true
+	case isUintKind(av.Kind()) && isUintKind(bv.Kind()):
+		return compareUint64(av.Uint(), bv.Uint()), true
+	case isNumberKind(av.Kind()) && isNumberKind(bv.Kind()):
+		return compareFloat64(toFloat64(av), toFloat64(bv)), true
+	case av.Kind() == reflect.String && bv.Kind() == reflect.String:
+		return strings.Compare(av.String(), bv.String()), true
+	case av.Kind() == reflect.Bool && bv.Kind() == reflect.Bool:
+		if av.Bool() == bv.Bool() {
+			return 0, true
+		}
+		if bv.Bool() {
+			return -1, true
+		}
+		return 1, true
+	case av.Type() == typeOfBytes && bv.Type() == typeOfBytes:
+		return bytes.Compare(av.Bytes(), bv.Bytes()), true
+	}
+	return 0, false
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return isIntKind(kind) || isUintKind(kind) || kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func toFloat64(v reflect.Value) float64 {
+	switch {
+	case isIntKind(v.Kind()):
+		return float64(v.Int())
+	case isUintKind(v.Kind()):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func compareInt64(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareUint64(a, b uint64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(a, b float64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
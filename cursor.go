@@ -0,0 +1,105 @@
+package stored
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrCursorInvalid returned when cursor passed to After was modified, signed with another secret
+// or belongs to another query
+var ErrCursorInvalid = errors.New("Cursor is invalid")
+
+// cursorMacLen is the length of signature appended to the cursor
+const cursorMacLen = 16
+
+var cursorSecret = randomCursorSecret()
+
+func randomCursorSecret() []byte {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// SetCursorSecret sets the key used to sign pagination cursors. By default random key is generated
+// on start, so set the same secret on every process cursors are passed between
+func SetCursorSecret(secret []byte) {
+	if len(secret) == 0 {
+		panic("cursor secret should not be empty")
+	}
+	cursorSecret = append([]byte{}, secret...)
+}
+
+// cursor is serialisable position of the scan
+type cursor struct {
+	Scope   string `msgpack:"s"` // kind of scan and name of the index
+	Reverse bool   `msgpack:"r"`
+	Key     []byte `msgpack:"k"` // last scanned key, next page starts right after it
+	Begin   []byte `msgpack:"b"` // bounds of the scanned range
+	End     []byte `msgpack:"e"`
+}
+
+func newCursor(scope string, bounds fdb.KeyRange, reverse bool, key fdb.Key) *cursor {
+	return &cursor{
+		Scope:   scope,
+		Reverse: reverse,
+		Key:     key,
+		Begin:   bounds.Begin.FDBKey(),
+		End:     bounds.End.FDBKey(),
+	}
+}
+
+func cursorMac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)[:cursorMacLen]
+}
+
+// encode returns signed token
+func (c *cursor) encode() string {
+	payload, err := msgpack.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, cursorMac(payload)...))
+}
+
+// decodeCursor checks signature of the token and decodes it
+func decodeCursor(token string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) <= cursorMacLen {
+		return nil, ErrCursorInvalid
+	}
+	payload := data[:len(data)-cursorMacLen]
+	if !hmac.Equal(data[len(data)-cursorMacLen:], cursorMac(payload)) {
+		return nil, ErrCursorInvalid
+	}
+	c := cursor{}
+	err = msgpack.Unmarshal(payload, &c)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	return &c, nil
+}
+
+// resume decodes token and checks it belongs to the same scan, returns key to continue from
+func resumeCursor(token string, scope string, bounds fdb.KeyRange, reverse bool) (fdb.Key, error) {
+	c, err := decodeCursor(token)
+	if err != nil {
+		return nil, err
+	}
+	if c.Scope != scope || c.Reverse != reverse ||
+		!bytes.Equal(c.Begin, bounds.Begin.FDBKey()) || !bytes.Equal(c.End, bounds.End.FDBKey()) {
+		return nil, ErrCursorInvalid
+	}
+	return c.Key, nil
+}
@@ -0,0 +1,128 @@
+package stored
+
+import (
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+// QueryStats describes execution of the query
+type QueryStats struct {
+	KeysRead  int // keys read from scanned primary or index ranges
+	BytesRead int // size of keys and values read from scanned ranges
+	Fetched   int // objects fetched by primary after index scan
+	Filtered  int // objects skipped by conditions not resolved by indexes and by filters
+	Skipped   int // indexes not intersected as exceeding DefaultIntersectKeys
+	Returned  int // objects returned
+}
+
+func (s *QueryStats) read(kv fdb.KeyValue) {
+	if s == nil {
+		return
+	}
+	s.KeysRead++
+	s.BytesRead += len(kv.Key) + len(kv.Value)
+}
+
+func (s *QueryStats) fetch() {
+	if s != nil {
+		s.Fetched++
+	}
+}
+
+func (s *QueryStats) filter() {
+	if s != nil {
+		s.Filtered++
+	}
+}
+
+func (s *QueryStats) skip() {
+	if s != nil {
+		s.Skipped++
+	}
+}
+
+// Explain describes how the query was resolved
+type Explain struct {
+	Index          string         // index driving the scan, empty for primary scan
+	Intersect      []string       // indexes primary keys of which are intersected with the driving index
+	Ranges         []fdb.KeyRange // scanned ranges
+	Residual       []string       // conditions checked on fetched objects
+	Filters        int            // number of Filter callbacks
+	Sort           string         // "index" if OrderBy is resolved by the scan order, "memory" if objects are sorted in memory
+	EstimatedBytes int64          // size of scanned ranges estimated by FoundationDB
+	EstimatedKeys  int64          // number of keys estimated using average size of keys read
+	Stats          QueryStats     // actual execution stats
+}
+
+// Explain executes the query and describes the chosen plan along with execution stats. Pagination
+// state of the query is not changed. FoundationDB estimates size of small ranges inaccurately
+func (q *Query) Explain() (*Explain, error) {
+	run := *q
+	run.next.from = nil
+	run.next.resume = nil
+	run.next.cursor = nil
+	run.next.started = false
+	err := run.applyAfter()
+	if err != nil {
+		return nil, err
+	}
+
+	explain := Explain{Filters: len(q.filters)}
+	if q.order != nil {
+		explain.Sort = "memory"
+		if run.orderedByIndex() {
+			explain.Sort = "index"
+		}
+	}
+	plan := run.getPlan()
+	if len(plan.scans) == 0 {
+		r, ok := resumeRange(run.primaryRange(), run.resume, run.reverse)
+		if ok {
+			explain.Ranges = []fdb.KeyRange{r}
+		}
+	} else {
+		explain.Index = plan.scans[0].index.Name
+		for _, scan := range plan.scans[1:] {
+			explain.Intersect = append(explain.Intersect, scan.index.Name)
+		}
+		for _, r := range plan.scans[0].ranges {
+			r, ok := resumeRange(r, run.resume, run.reverse)
+			if ok {
+				explain.Ranges = append(explain.Ranges, r)
+			}
+		}
+	}
+	for k := range plan.residual {
+		explain.Residual = append(explain.Residual, plan.residual[k].String())
+	}
+
+	p := run.execute()
+	err = p.Err()
+	if err != nil {
+		return nil, err
+	}
+	explain.Stats = *p.Stats()
+
+	estimated, err := q.object.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+		futures := make([]fdb.FutureInt64, len(explain.Ranges))
+		for k, r := range explain.Ranges {
+			futures[k] = tr.GetEstimatedRangeSizeBytes(r)
+		}
+		var total int64
+		for _, future := range futures {
+			size, err := future.Get()
+			if err != nil {
+				return nil, err
+			}
+			total += size
+		}
+		return total, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	explain.EstimatedBytes = estimated.(int64)
+	if explain.Stats.KeysRead > 0 {
+		explain.EstimatedKeys = explain.EstimatedBytes * int64(explain.Stats.KeysRead) / int64(explain.Stats.BytesRead)
+	}
+	return &explain, nil
+}
@@ -0,0 +1,556 @@
+package stored
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ExportFormat is serialization format of Export and Import
+type ExportFormat int
+
+const (
+	// FormatJSON writes one JSON document per line
+	FormatJSON ExportFormat = iota
+	// FormatMsgpack writes msgpack documents each prefixed with 4 byte big-endian length
+	FormatMsgpack
+)
+
+// ExportOption is the option struct of Export and Import
+type ExportOption struct {
+	// Format of the stream, JSON lines by default
+	Format ExportFormat
+	// Batch is the number of rows read or written within one transaction, 100 by default
+	Batch int
+	// Snapshot makes export read all objects at one read version, so the dump is consistent.
+	// Export should fit into lifetime of the read version (5 seconds), otherwise ErrSnapshotTooOld
+	// is returned
+	Snapshot bool
+}
+
+// ErrSchemeMismatch returned by Import when exported fields have other types than the declared object
+var ErrSchemeMismatch = errors.New("Exported scheme does not match the object")
+
+// exportRecord is one document of the stream: object scheme, object row or relation edge
+type exportRecord struct {
+	Object     string              `json:"object,omitempty" msgpack:"object,omitempty"`
+	Version    uint64              `json:"version,omitempty" msgpack:"version,omitempty"`
+	Fields     map[string]string   `json:"fields,omitempty" msgpack:"fields,omitempty"` // field types, set by scheme record preceding rows
+	Data       map[string]rawValue `json:"data,omitempty" msgpack:"data,omitempty"`
+	Relation   string              `json:"relation,omitempty" msgpack:"relation,omitempty"`
+	Host       []byte              `json:"host,omitempty" msgpack:"host,omitempty"`     // packed primary of the host
+	Client     []byte              `json:"client,omitempty" msgpack:"client,omitempty"` // packed primary of the client
+	HostData   []byte              `json:"host_data,omitempty" msgpack:"host_data,omitempty"`
+	ClientData []byte              `json:"client_data,omitempty" msgpack:"client_data,omitempty"`
+}
+
+// rawValue keeps encoded field value until the type of the field is known
+type rawValue []byte
+
+// MarshalJSON writes encoded value as is
+func (r rawValue) MarshalJSON() ([]byte, error) {
+	return r, nil
+}
+
+// UnmarshalJSON keeps encoded value
+func (r *rawValue) UnmarshalJSON(data []byte) error {
+	*r = append((*r)[:0], data...)
+	return nil
+}
+
+// EncodeMsgpack writes encoded value as is
+func (r rawValue) EncodeMsgpack(enc *msgpack.Encoder) error {
+	return enc.Encode(msgpack.RawMessage(r))
+}
+
+// DecodeMsgpack keeps encoded value
+func (r *rawValue) DecodeMsgpack(dec *msgpack.Decoder) error {
+	raw, err := dec.DecodeRaw()
+	*r = rawValue(raw)
+	return err
+}
+
+func (f ExportFormat) marshal(value interface{}) ([]byte, error) {
+	if f == FormatMsgpack {
+		return msgpack.Marshal(value)
+	}
+	return json.Marshal(value)
+}
+
+func (f ExportFormat) unmarshal(data []byte, value interface{}) error {
+	if f == FormatMsgpack {
+		return msgpack.Unmarshal(data, value)
+	}
+	return json.Unmarshal(data, value)
+}
+
+func exportOption(options []ExportOption) ExportOption {
+	option := ExportOption{Batch: 100}
+	for _, opt := range options {
+		option.Format = opt.Format
+		option.Snapshot = opt.Snapshot
+		if opt.Batch > 0 {
+			option.Batch = opt.Batch
+		}
+	}
+	return option
+}
+
+// relationName returns name of the relation used inside the stream
+func relationName(r *Relation) string {
+	path := []string{r.host.name, r.client.name}
+	if r.name != "" {
+		path = append(path, r.name)
+	}
+	return strings.Join(path, "/")
+}
+
+type exporter struct {
+	db      *fdb.Database
+	writer  *bufio.Writer
+	option  ExportOption
+	version int64 // pinned read version in snapshot mode
+}
+
+// Export writes rows of the objects and relations they host to the writer as JSON lines. All objects
+// of the directory are exported if none passed
+func (d *Directory) Export(w io.Writer, objects ...*Object) error {
+	return d.ExportWith(w, ExportOption{}, objects...)
+}
+
+// ExportWith writes rows of the objects and relations they host to the writer using the options.
+// Rows are read by batches within separate read transactions
+func (d *Directory) ExportWith(w io.Writer, option ExportOption, objects ...*Object) error {
+	option = exportOption([]ExportOption{option})
+	if len(objects) == 0 {
+		objects = d.objectsList()
+	}
+	e := exporter{
+		db:     &d.Cluster.db,
+		writer: bufio.NewWriter(w),
+		option: option,
+	}
+	if option.Snapshot {
+		tr, err := e.db.CreateTransaction()
+		if err != nil {
+			return err
+		}
+		e.version, err = tr.GetReadVersion().Get()
+		if err != nil {
+			return err
+		}
+	}
+	for _, o := range objects {
+		err := e.object(o)
+		if err != nil {
+			return err
+		}
+		for _, r := range o.Relations {
+			err = e.relation(r)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return e.writer.Flush()
+}
+
+// objectsList returns declared objects of the directory sorted by name
+func (d *Directory) objectsList() []*Object {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	objects := make([]*Object, 0, len(d.objects))
+	for _, o := range d.objects {
+		objects = append(objects, o)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].name < objects[j].name
+	})
+	return objects
+}
+
+func (e *exporter) write(record *exportRecord) error {
+	data, err := e.option.Format.marshal(record)
+	if err != nil {
+		return err
+	}
+	if e.option.Format == FormatMsgpack {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(data)))
+		_, err = e.writer.Write(size)
+	} else {
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	_, err = e.writer.Write(data)
+	return err
+}
+
+// exportFields returns types of the fields written to the stream
+func (o *Object) exportFields() map[string]string {
+	fields := map[string]string{}
+	for _, field := range o.getFields() {
+		if !field.UnStored {
+			fields[field.Name] = field.Type.Type.String()
+		}
+	}
+	return fields
+}
+
+func (e *exporter) object(o *Object) error {
+	err := e.write(&exportRecord{Object: o.name, Version: o.schemeVersion, Fields: o.exportFields()})
+	if err != nil {
+		return err
+	}
+	it := o.ListAll().Iter().Batch(e.option.Batch)
+	if e.option.Snapshot {
+		it.Snapshot()
+		it.version = e.version
+	}
+	for it.Next() {
+		value, err := it.Value().Reflect()
+		if err != nil {
+			return err
+		}
+		record := exportRecord{
+			Object:  o.name,
+			Version: o.schemeVersion,
+			Data:    map[string]rawValue{},
+		}
+		for _, field := range o.getFields() {
+			if field.UnStored {
+				continue
+			}
+			data, err := e.option.Format.marshal(value.Field(field.Num).Interface())
+			if err != nil {
+				return err
+			}
+			record.Data[field.Name] = data
+		}
+		err = e.write(&record)
+		if err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// relation writes all edges of the relation using host side keys
+func (e *exporter) relation(r *Relation) error {
+	hostLen := len(r.host.primaryFields)
+	begin, end := r.hostDir.FDBRangeKeys()
+	keyRange := fdb.KeyRange{Begin: begin, End: end}
+	for {
+		records := []exportRecord{}
+		_, err := e.readTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+			records = records[:0]
+			rows, err := tr.GetRange(keyRange, fdb.RangeOptions{Limit: e.option.Batch}).GetSliceWithError()
+			if err != nil {
+				return nil, err
+			}
+			hostData := make([]fdb.FutureByteSlice, len(rows))
+			for k, kv := range rows {
+				key, err := r.hostDir.Unpack(kv.Key)
+				if err != nil {
+					return nil, err
+				}
+				if len(key) <= hostLen {
+					return nil, ErrDataCorrupt
+				}
+				hostPrimary, clientPrimary := key[:hostLen], key[hostLen:]
+				hostData[k] = tr.Get(r.clientDir.Sub(clientPrimary...).Pack(hostPrimary))
+				records = append(records, exportRecord{
+					Relation:   relationName(r),
+					Host:       hostPrimary.Pack(),
+					Client:     clientPrimary.Pack(),
+					ClientData: kv.Value,
+				})
+			}
+			for k := range records {
+				records[k].HostData, err = hostData[k].Get()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if len(rows) == e.option.Batch {
+				keyRange.Begin = fdb.Key(append(rows[len(rows)-1].Key, 0x00))
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+		for k := range records {
+			err = e.write(&records[k])
+			if err != nil {
+				return err
+			}
+		}
+		if len(records) < e.option.Batch {
+			return nil
+		}
+	}
+}
+
+// readTransact runs read transaction, at pinned read version in snapshot mode
+func (e *exporter) readTransact(fn func(tr fdb.ReadTransaction) (interface{}, error)) (interface{}, error) {
+	if e.version == 0 {
+		return e.db.ReadTransact(fn)
+	}
+	tr, err := e.db.CreateTransaction()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tr.SetReadVersion(e.version)
+		res, err := fn(tr.Snapshot())
+		if err == nil {
+			return res, nil
+		}
+		fdbErr, ok := err.(fdb.Error)
+		if !ok {
+			return nil, err
+		}
+		if fdbErr.Code == transactionTooOld {
+			return nil, ErrSnapshotTooOld
+		}
+		err = tr.OnError(fdbErr).Get()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// importer collects records into batches and writes them
+type importer struct {
+	directory *Directory
+	option    ExportOption
+	objects   map[string]*Object
+	relations map[string]*Relation
+	checked   map[string]bool // objects which scheme records were checked
+	batch     []*Promise
+	lastIDs   map[*Field]int64 // max autoincrement values of imported rows
+}
+
+// Import reads the stream written by Export and writes rows and relation edges. Existing rows with same
+// primary are overwritten, indexes, counters and relations are rebuilt, autoincrement counters are moved
+// past imported ids. Objects should be declared inside the directory before import. Rows are matched with
+// fields by name: removed fields are skipped, added ones are left empty, ErrSchemeMismatch is returned if
+// type of the field changed
+func (d *Directory) Import(r io.Reader, options ...ExportOption) error {
+	option := exportOption(options)
+	im := importer{
+		directory: d,
+		option:    option,
+		objects:   map[string]*Object{},
+		relations: map[string]*Relation{},
+		checked:   map[string]bool{},
+		lastIDs:   map[*Field]int64{},
+	}
+	for _, o := range d.objectsList() {
+		im.objects[o.name] = o
+		for _, rel := range o.Relations {
+			im.relations[relationName(rel)] = rel
+		}
+	}
+
+	reader := bufio.NewReader(r)
+	var decoder *json.Decoder
+	if option.Format == FormatJSON {
+		decoder = json.NewDecoder(reader)
+	}
+	for {
+		record := exportRecord{}
+		var err error
+		if decoder != nil {
+			err = decoder.Decode(&record)
+		} else {
+			err = readMsgpackRecord(reader, &record)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = im.add(&record)
+		if err != nil {
+			return err
+		}
+		if len(im.batch) >= option.Batch {
+			err = im.flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := im.flush()
+	if err != nil {
+		return err
+	}
+	return im.moveAutoIncrement()
+}
+
+func readMsgpackRecord(reader io.Reader, record *exportRecord) error {
+	size := make([]byte, 4)
+	_, err := io.ReadFull(reader, size)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size))
+	_, err = io.ReadFull(reader, data)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	return msgpack.Unmarshal(data, record)
+}
+
+// add converts the record into the promise of the batch
+func (im *importer) add(record *exportRecord) error {
+	if record.Relation != "" {
+		rel, ok := im.relations[record.Relation]
+		if !ok {
+			return fmt.Errorf("relation «%s» is not declared", record.Relation)
+		}
+		hostPrimary, err := tuple.Unpack(record.Host)
+		if err != nil {
+			return err
+		}
+		clientPrimary, err := tuple.Unpack(record.Client)
+		if err != nil {
+			return err
+		}
+		im.batch = append(im.batch, rel.restore(hostPrimary, clientPrimary, record.HostData, record.ClientData).self())
+		return nil
+	}
+	o, ok := im.objects[record.Object]
+	if !ok {
+		return fmt.Errorf("object «%s» is not declared", record.Object)
+	}
+	if record.Fields != nil {
+		return im.checkScheme(o, record)
+	}
+	if !im.checked[o.name] && record.Version != o.schemeVersion {
+		return fmt.Errorf("%w: rows of «%s» are exported by scheme version %d without field types, current version is %d",
+			ErrSchemeMismatch, o.name, record.Version, o.schemeVersion)
+	}
+	value := reflect.New(o.reflectType)
+	for fieldName, data := range record.Data {
+		field, ok := o.immutableFields[fieldName]
+		if !ok {
+			field, ok = o.mutableFields[fieldName]
+		}
+		if !ok { // field was removed from the object
+			continue
+		}
+		err := im.option.Format.unmarshal(data, value.Elem().Field(field.Num).Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("object «%s» field «%s»: %s", o.name, fieldName, err)
+		}
+		if field.AutoIncrement {
+			id := reflect.Indirect(value.Elem().Field(field.Num))
+			last := int64(0)
+			if isUintKind(id.Kind()) {
+				last = int64(id.Uint())
+			} else if isIntKind(id.Kind()) {
+				last = id.Int()
+			}
+			if last > im.lastIDs[field] {
+				im.lastIDs[field] = last
+			}
+		}
+	}
+	im.batch = append(im.batch, o.Upsert(value.Interface(), nil).self())
+	return nil
+}
+
+// checkScheme compares types of exported fields with fields of the object
+func (im *importer) checkScheme(o *Object, record *exportRecord) error {
+	for fieldName, exported := range record.Fields {
+		field, ok := o.immutableFields[fieldName]
+		if !ok {
+			field, ok = o.mutableFields[fieldName]
+		}
+		if !ok { // field was removed from the object
+			continue
+		}
+		if declared := field.Type.Type.String(); declared != exported {
+			return fmt.Errorf("%w: field «%s» of «%s» is exported as %s, object declares %s",
+				ErrSchemeMismatch, fieldName, o.name, exported, declared)
+		}
+	}
+	im.checked[o.name] = true
+	return nil
+}
+
+// flush writes collected promises within one transaction
+func (im *importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	t := Transaction{db: &im.directory.Cluster.db}
+	for _, promise := range im.batch {
+		t.tasks = append(t.tasks, transactionTask{promise: promise, check: true})
+	}
+	im.batch = nil
+	return t.Err()
+}
+
+// moveAutoIncrement makes autoincrement counters greater or equal than imported ids
+func (im *importer) moveAutoIncrement() error {
+	if len(im.lastIDs) == 0 {
+		return nil
+	}
+	_, err := im.directory.Cluster.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		for field, last := range im.lastIDs {
+			buf := make([]byte, 8)
+			binary.LittleEndian.PutUint64(buf, uint64(last))
+			tr.Max(field.object.miscDir.Pack(tuple.Tuple{"ai", field.Name}), buf[:len(GetPlus(field.Kind))])
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// restore writes the relation edge with already encoded data, counters are changed if edge is new
+func (r *Relation) restore(hostPrimary, clientPrimary tuple.Tuple, hostVal, clientVal []byte) *PromiseErr {
+	p := r.host.promiseErr()
+	p.do(func() Chain {
+		hostKey := r.hostDir.Sub(hostPrimary...).Pack(clientPrimary)
+		if r.counter {
+			val, err := p.tr.Get(hostKey).Get()
+			if err != nil {
+				return p.fail(err)
+			}
+			if val == nil {
+				p.tr.Add(r.infoDir.Sub(keyRelHostCount).Pack(hostPrimary), countInc)
+				r.changeClientCounter(clientPrimary, p, 1)()
+			}
+		}
+		if hostVal == nil {
+			hostVal = []byte{}
+		}
+		if clientVal == nil {
+			clientVal = []byte{}
+		}
+		p.tr.Set(hostKey, clientVal)
+		p.tr.Set(r.clientDir.Sub(clientPrimary...).Pack(hostPrimary), hostVal)
+		return p.ok()
+	})
+	return p
+}
@@ -1,11 +1,13 @@
 package stored
 
 import (
+	"encoding/binary"
 	"fmt"
 	"github.com/vmihailenco/msgpack/v5"
 	"math/rand"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
@@ -26,8 +28,12 @@ type Field struct {
 	mutable       bool
 	primary       bool
 	AutoIncrement bool
-	GenID         GenIDType // type of ID autogeneration, IDDate, IDRandom
-	UnStored      bool      // means this field would not be stored inside main object
+	GenID         GenIDType   // type of ID autogeneration, IDDate, IDRandom
+	UnStored      bool        // means this field would not be stored inside main object
+	codec         codecType   // special encoding of the field type
+	elem          *Field      // type wrapped by nullable field
+	rules         *fieldRules // declared by tag options, nil if there are no rules
+	native        bool        // stored as 8 byte little-endian integer, declared by atomic tag option
 }
 
 // Tag is general object for tag parsing
@@ -37,7 +43,9 @@ type Tag struct {
 	mutable       bool
 	unique        bool
 	AutoIncrement bool
-	UnStored      bool // means this field doesn't stored inside main object data
+	UnStored      bool              // means this field doesn't stored inside main object data
+	atomic        bool              // mutable integer stored for FDB atomic mutations
+	rules         map[string]string // validation options and default value
 }
 
 // ParseTag converts object stored tag to sturct with options
@@ -66,18 +74,61 @@ func (f *Field) ParseTag() *Tag {
 				tag.mutable = true
 			case "unique":
 				tag.unique = true
+			case "index":
+				// index hint for cmd/stored, index itself is declared with ObjectBuilder.Index
 			case "autoincrement":
 				tag.AutoIncrement = true
+			case "atomic":
+				tag.atomic = true
+			case "required":
+				tag.setRule(part, "")
 			default:
-				panic("tag «" + tag.Name + "» has unsupported ‘" + part + "’ option")
+				option, value, ok := strings.Cut(part, "=")
+				switch {
+				case ok && option == "regexp":
+					// expression could contain commas, so it takes the rest of the tag
+					pattern := strings.TrimSpace(strings.SplitN(tagStr, "regexp=", 2)[1])
+					for _, rest := range strings.Split(pattern, ",")[1:] {
+						rest = strings.TrimSpace(rest)
+						if isTagOption(rest) {
+							panic("tag «" + tag.Name + "» has ‘" + rest + "’ option after regexp, regexp should be the last option")
+						}
+					}
+					tag.setRule(option, pattern)
+					return &tag
+				case ok && (option == "default" || option == "min" || option == "max" || option == "maxlen"):
+					tag.setRule(option, value)
+				default:
+					panic("tag «" + tag.Name + "» has unsupported ‘" + part + "’ option")
+				}
 			}
 		}
 	}
 	return &tag
 }
 
-// GetDefault return default value for this field
+// isTagOption checks if the part of the tag is known option
+func isTagOption(part string) bool {
+	switch part {
+	case "primary", "mutable", "unique", "index", "autoincrement", "atomic", "required":
+		return true
+	}
+	option, _, ok := strings.Cut(part, "=")
+	return ok && (option == "default" || option == "min" || option == "max" || option == "maxlen" || option == "regexp")
+}
+
+func (t *Tag) setRule(option, value string) {
+	if t.rules == nil {
+		t.rules = map[string]string{}
+	}
+	t.rules[option] = value
+}
+
+// GetDefault return default value for this field, declared with default tag option or zero value
 func (f *Field) GetDefault() interface{} {
+	if f.rules != nil && f.rules.defaultValue.IsValid() {
+		return f.rules.defaultValue.Interface()
+	}
 	switch f.Kind {
 	case reflect.String:
 		return ""
@@ -94,7 +145,10 @@ func (f *Field) GetDefault() interface{} {
 	case reflect.Uint64:
 		return uint64(0)
 	default:
-		panic("unsupported type for getdefault " + fmt.Sprintf("%v", f.Kind))
+		if f.Type.Type == nil {
+			panic("unsupported type for getdefault " + fmt.Sprintf("%v", f.Kind))
+		}
+		return reflect.Zero(f.Type.Type).Interface() // time.Time and other types
 	}
 }
 
@@ -103,27 +157,18 @@ func (f *Field) isEmpty(value interface{}) bool {
 	if value == nil {
 		return true
 	}
+	if f.nullable() {
+		return f.isNull(value) // zero values are not empty
+	}
+	if t, ok := value.(time.Time); ok {
+		return t.IsZero()
+	}
 	switch f.Kind { // slices and maps will be nil if not set
-	case reflect.String:
-		return "" == value
-	case reflect.Int:
-		return 0 == value
-	case reflect.Int32:
-		return int32(0) == value
-	case reflect.Int64:
-		return int64(0) == value
-	case reflect.Uint:
-		return uint(0) == value
-	case reflect.Uint32:
-		return uint32(0) == value
-	case reflect.Uint64:
-		return uint64(0) == value
-	case reflect.Float32:
-		return float32(0.0) == value
-	case reflect.Float64:
-		return float64(0.0) == value
-	case reflect.Bool:
-		return false == value
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// named types like time.Duration are compared by value too
+		return reflect.ValueOf(value).IsZero()
 	default:
 		return false
 	}
@@ -147,31 +192,122 @@ func (f *Field) BytesFromObject(objectValue interface{}) ([]byte, error) {
 
 // ToBytes packs interface field value to bytes
 func (f *Field) ToBytes(val interface{}) ([]byte, error) {
+	if f.nullable() {
+		if f.isNull(val) {
+			return msgpackNil, nil
+		}
+		return f.elem.ToBytes(f.unwrap(val))
+	}
+	if f.codec.custom() {
+		data, err := f.encodeCustom(val)
+		if err != nil {
+			return nil, err
+		}
+		return msgpack.Marshal(data)
+	}
 	return msgpack.Marshal(val)
 }
 
 func (f *Field) tupleElement(val interface{}) tuple.TupleElement {
-	if f.Kind == reflect.Uint8 { // byte stored as byte array
-		return []byte{val.(byte)}
+	if f.nullable() {
+		if f.isNull(val) {
+			return nil
+		}
+		return f.elem.tupleElement(f.unwrap(val))
+	}
+	if t, ok := val.(time.Time); ok {
+		return timeElement(t)
+	}
+	if f.codec.custom() && reflect.TypeOf(val) == f.Type.Type {
+		data, err := f.encodeCustom(val)
+		if err != nil {
+			f.panic("could not be encoded: " + err.Error())
+		}
+		return data
+	}
+	if b, ok := val.(byte); ok && f.Kind == reflect.Uint8 { // byte stored as byte array
+		return []byte{b}
+	}
+	return tupleBase(val)
+}
+
+// tupleBase converts values of named types like time.Duration to the types tuple packs
+func tupleBase(val interface{}) interface{} {
+	value := reflect.ValueOf(val)
+	if !value.IsValid() || value.Type().PkgPath() == "" {
+		return val
+	}
+	switch kind := value.Kind(); {
+	case isIntKind(kind):
+		return value.Int()
+	case isUintKind(kind):
+		return value.Uint()
+	case kind == reflect.Float32:
+		return float32(value.Float())
+	case kind == reflect.Float64:
+		return value.Float()
+	case kind == reflect.String:
+		return value.String()
+	case kind == reflect.Bool:
+		return value.Bool()
 	}
 	return val
 }
 
-func (f *Field) setTupleValue(value reflect.Value, interfaceValue interface{}) {
+// fromTupleElement converts value decoded from key tuple to the type of the field
+func (f *Field) fromTupleElement(el tuple.TupleElement) interface{} {
+	if f.nullable() {
+		if el == nil {
+			return reflect.Zero(f.Type.Type).Interface()
+		}
+		value := reflect.ValueOf(f.elem.fromTupleElement(el))
+		if !value.Type().ConvertibleTo(f.elem.Type.Type) {
+			return el
+		}
+		return f.wrap(value).Interface()
+	}
+	if f.codec == codecTime {
+		if t, ok := timeFromElement(el); ok {
+			return t
+		}
+		return el
+	}
+	if f.codec.custom() {
+		if data, ok := el.([]byte); ok {
+			if value, err := f.decodeCustom(data); err == nil {
+				return value.Interface()
+			}
+		}
+		return el
+	}
+	if f.Kind == reflect.Uint8 {
+		if bytes, ok := el.([]byte); ok && len(bytes) == 1 {
+			return bytes[0]
+		}
+		return el
+	}
+	value := reflect.ValueOf(el)
+	if value.IsValid() && isNumberKind(value.Kind()) && isNumberKind(f.Kind) {
+		return value.Convert(f.Type.Type).Interface()
+	}
+	if value.IsValid() && value.Kind() == reflect.String && f.Kind == reflect.String {
+		return value.Convert(f.Type.Type).Interface()
+	}
+	return el
+}
+
+// setKeyValue sets field value decoded from key tuple, converting it to the type of the field
+func (f *Field) setKeyValue(value reflect.Value, el tuple.TupleElement) {
 	objField := value.Field(f.Num)
-	switch objField.Kind() {
-	case reflect.Int: // tuple store int as int64
-		interfaceValue = int(interfaceValue.(int64))
-	case reflect.Uint8:
-		bytes := interfaceValue.([]uint8)
-		if len(bytes) != 1 {
-			panic("incorrect key tuple")
-		}
-		interfaceValue = bytes[0]
-	case reflect.Uint64:
-		interfaceValue = uint64(interfaceValue.(int64))
+	val := reflect.ValueOf(f.fromTupleElement(el))
+	if val.IsValid() && val.Type().ConvertibleTo(objField.Type()) {
+		objField.Set(val.Convert(objField.Type()))
 	}
-	objField.Set(reflect.ValueOf(interfaceValue))
+}
+
+func (f *Field) setTupleValue(value reflect.Value, interfaceValue interface{}) {
+	// tuple stores all integers as int64, time as nested tuple, so value is converted to the field type
+	f.setKeyValue(value, interfaceValue)
 }
 
 func (f *Field) getKey(sub subspace.Subspace) fdb.Key {
@@ -179,14 +315,79 @@ func (f *Field) getKey(sub subspace.Subspace) fdb.Key {
 }
 
 // ToInterface decodes field value
-func (f *Field) ToInterface(obj []byte) interface{} {
+func (f *Field) ToInterface(obj []byte) (interface{}, error) {
+	if f.nullable() {
+		value, err := f.decodeNullable(obj)
+		if err != nil {
+			return nil, err
+		}
+		return value.Interface(), nil
+	}
+	if f.isNative(obj) {
+		return f.fromNative(obj).Interface(), nil
+	}
 	var i interface{}
 	err := msgpack.Unmarshal(obj, &i)
 	if err != nil {
-		fmt.Println("ToInterface failed:", err)
+		return nil, fmt.Errorf("field «%s» could not be decoded: %v", f.Name, err)
+	}
+	if data, ok := i.([]byte); ok && f.codec.custom() {
+		value, err := f.decodeCustom(data)
+		if err != nil {
+			return nil, fmt.Errorf("field «%s» could not be decoded: %v", f.Name, err)
+		}
+		return value.Interface(), nil
 	}
 
-	return i
+	return i, nil
+}
+
+// atomic checks if the field is stored as 8 byte little-endian integer, so FDB atomic mutations
+// could be applied to its key
+func (f *Field) atomic() bool {
+	return f.native
+}
+
+// isNative checks if stored bytes are little-endian integer. msgpack never encodes integers
+// with 8 bytes, so values written before are still decoded as msgpack, and values written natively
+// are decoded after atomic option is removed
+func (f *Field) isNative(data []byte) bool {
+	return f.mutable && (isIntKind(f.Kind) || isUintKind(f.Kind)) && len(data) == 8
+}
+
+// nativeBytes encodes integer value as 8 byte little-endian
+func (f *Field) nativeBytes(value reflect.Value) []byte {
+	data := make([]byte, 8)
+	if isIntKind(value.Kind()) {
+		binary.LittleEndian.PutUint64(data, uint64(value.Int()))
+	} else {
+		binary.LittleEndian.PutUint64(data, value.Uint())
+	}
+	return data
+}
+
+// fromNative decodes little-endian integer to the value of the field type
+func (f *Field) fromNative(data []byte) reflect.Value {
+	n := binary.LittleEndian.Uint64(data)
+	value := reflect.New(f.Type.Type).Elem()
+	if isIntKind(f.Kind) {
+		value.SetInt(int64(n))
+	} else {
+		value.SetUint(n)
+	}
+	return value
+}
+
+// valueBytes encodes value of the field the way it is stored inside the field key
+func (f *Field) valueBytes(val interface{}) ([]byte, error) {
+	if f.atomic() {
+		value := reflect.ValueOf(val)
+		if !value.Type().ConvertibleTo(f.Type.Type) {
+			return nil, fmt.Errorf("value of type %s could not be stored to field «%s»", value.Type(), f.Name)
+		}
+		return f.nativeBytes(value.Convert(f.Type.Type)), nil
+	}
+	return f.ToBytes(val)
 }
 
 func SetToField(obj []byte, objField reflect.Value) {
@@ -0,0 +1,176 @@
+package stored
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// FieldCodec could be implemented by types of fields to control the way they are stored.
+// Encoded bytes are also used inside index keys, so they are ordered bytewise
+type FieldCodec interface {
+	EncodeStored() ([]byte, error)
+	DecodeStored(data []byte) error // should be implemented with pointer receiver
+}
+
+// codecType describes the way field of special type is encoded
+type codecType int
+
+const (
+	codecNone codecType = iota
+	codecTime
+	codecCustom  // FieldCodec
+	codecBinary  // encoding.BinaryMarshaler
+	codecPointer // pointer, nil is stored as null
+	codecNull    // Null, unset value is stored as null
+)
+
+var typeOfTime = reflect.TypeOf(time.Time{})
+var typeOfFieldCodec = reflect.TypeOf((*FieldCodec)(nil)).Elem()
+var typeOfBinaryMarshaler = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+var typeOfBinaryUnmarshaler = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+// codecOf detects codec of the field type, FieldCodec takes precedence over BinaryMarshaler
+// which time.Time also implements
+func codecOf(t reflect.Type) codecType {
+	ptr := reflect.PtrTo(t)
+	switch {
+	case t.Kind() == reflect.Ptr:
+		return codecPointer
+	case t.Implements(typeOfNull):
+		return codecNull
+	case ptr.Implements(typeOfFieldCodec):
+		return codecCustom
+	case t == typeOfTime:
+		return codecTime
+	case ptr.Implements(typeOfBinaryMarshaler) && ptr.Implements(typeOfBinaryUnmarshaler):
+		return codecBinary
+	}
+	return codecNone
+}
+
+// custom checks if field value is encoded by the type itself
+func (c codecType) custom() bool {
+	return c == codecCustom || c == codecBinary
+}
+
+// encodeCustom encodes value using FieldCodec or BinaryMarshaler of the field type
+func (f *Field) encodeCustom(val interface{}) ([]byte, error) {
+	value := reflect.ValueOf(val)
+	if !value.IsValid() || value.Type() != f.Type.Type {
+		return nil, fmt.Errorf("value of field «%s» should be %s, got %T", f.Name, f.Type.Type, val)
+	}
+	ptr := reflect.New(f.Type.Type)
+	ptr.Elem().Set(value)
+	if f.codec == codecCustom {
+		return ptr.Interface().(FieldCodec).EncodeStored()
+	}
+	return ptr.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+}
+
+// decodeCustom decodes value of the field type using FieldCodec or BinaryUnmarshaler
+func (f *Field) decodeCustom(data []byte) (reflect.Value, error) {
+	ptr := reflect.New(f.Type.Type)
+	var err error
+	if f.codec == codecCustom {
+		err = ptr.Interface().(FieldCodec).DecodeStored(data)
+	} else {
+		err = ptr.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+	}
+	return ptr.Elem(), err
+}
+
+// packValue returns value of the field as it is put into packed immutable fields
+func (f *Field) packValue(value reflect.Value) (interface{}, error) {
+	if f.nullable() {
+		if f.isNull(value.Interface()) {
+			return nil, nil
+		}
+		return f.elem.packValue(reflect.ValueOf(f.unwrap(value.Interface())))
+	}
+	if !f.codec.custom() {
+		return value.Interface(), nil
+	}
+	return f.encodeCustom(value.Interface())
+}
+
+// setPacked sets field value decoded from packed immutable fields
+func (f *Field) setPacked(obj reflect.Value, data interface{}) error {
+	if f.nullable() {
+		if data == nil {
+			obj.Set(reflect.Zero(f.Type.Type))
+			return nil
+		}
+		value := reflect.New(f.elem.Type.Type).Elem()
+		err := f.elem.setPacked(value, data)
+		if err != nil {
+			return err
+		}
+		obj.Set(f.wrap(value))
+		return nil
+	}
+	if f.codec.custom() {
+		if data == nil {
+			return nil
+		}
+		bytes, ok := data.([]byte)
+		if !ok {
+			return fmt.Errorf("field «%s» should be packed as bytes, got %T", f.Name, data)
+		}
+		value, err := f.decodeCustom(bytes)
+		if err != nil {
+			return fmt.Errorf("field «%s» could not be decoded: %v", f.Name, err)
+		}
+		obj.Set(value)
+		return nil
+	}
+	setMsgPackObject(obj, data)
+	return nil
+}
+
+// queryElement converts value passed to a query into the tuple element the way field values are stored
+func queryElement(v interface{}) tuple.TupleElement {
+	switch val := v.(type) {
+	case byte:
+		return []byte{val}
+	case time.Time:
+		return timeElement(val)
+	case nullType:
+		value := reflect.ValueOf(val)
+		if !value.Field(1).Bool() {
+			return nil
+		}
+		return queryElement(value.Field(0).Interface())
+	}
+	if t := reflect.TypeOf(v); t != nil && codecOf(t).custom() {
+		field := Field{Name: "query", Type: reflect.StructField{Type: t}, codec: codecOf(t)}
+		data, err := field.encodeCustom(v)
+		if err != nil {
+			field.panic("value could not be encoded: " + err.Error())
+		}
+		return data
+	}
+	return tupleBase(v)
+}
+
+// timeElement encodes time as nested tuple of seconds and nanoseconds, so keys are ordered by time
+func timeElement(t time.Time) tuple.Tuple {
+	return tuple.Tuple{t.Unix(), int64(t.Nanosecond())}
+}
+
+// timeFromElement decodes time encoded by timeElement
+func timeFromElement(el tuple.TupleElement) (time.Time, bool) {
+	t, ok := el.(tuple.Tuple)
+	if !ok || len(t) != 2 {
+		return time.Time{}, false
+	}
+	sec, ok := t[0].(int64)
+	nsec, ok2 := t[1].(int64)
+	if !ok || !ok2 {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, nsec), true
+}
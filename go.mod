@@ -4,7 +4,13 @@ go 1.18
 
 require (
 	github.com/apple/foundationdb/bindings/go v0.0.0-20210602161635-7d8060e2fb2a
+	github.com/fatih/structtag v1.2.0
 	github.com/mmcloughlin/geohash v0.10.0
-	github.com/vmihailenco/msgpack/v4 v4.3.11 // indirect
-	github.com/vmihailenco/msgpack/v5 v5.3.4 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.3.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
 )
@@ -0,0 +1,107 @@
+package stored
+
+import (
+	"reflect"
+)
+
+// Hook is called inside the transaction of the write or the delete with pointers to the stored and the new
+// object: oldObj is nil for new objects, newObj is nil for deletes. Returned error cancels the operation, returned
+// promise is performed right after the operation within the same transaction and its error fails the operation
+type Hook func(tr *Transaction, oldObj, newObj interface{}) (PromiseAny, error)
+
+// hooks of the object lifecycle
+type hooks struct {
+	beforeWrite  []Hook
+	afterWrite   []Hook
+	beforeDelete []Hook
+	afterDelete  []Hook
+}
+
+// BeforeWrite adds hook called before Add, Set, Write, Update, Upsert, Patch and Atomic. Changes of the new object made by
+// the hook are written, except the primary key. Defaults and validation are applied after the hook
+func (ob *ObjectBuilder) BeforeWrite(hook Hook) *ObjectBuilder {
+	ob.mux.Lock()
+	ob.object.hooks.beforeWrite = append(ob.object.hooks.beforeWrite, hook)
+	ob.mux.Unlock()
+
+	return ob
+}
+
+// AfterWrite adds hook called once the object and its indexes are written
+func (ob *ObjectBuilder) AfterWrite(hook Hook) *ObjectBuilder {
+	ob.mux.Lock()
+	ob.object.hooks.afterWrite = append(ob.object.hooks.afterWrite, hook)
+	ob.mux.Unlock()
+
+	return ob
+}
+
+// BeforeDelete adds hook called before the object is deleted
+func (ob *ObjectBuilder) BeforeDelete(hook Hook) *ObjectBuilder {
+	ob.mux.Lock()
+	ob.object.hooks.beforeDelete = append(ob.object.hooks.beforeDelete, hook)
+	ob.mux.Unlock()
+
+	return ob
+}
+
+// AfterDelete adds hook called once the object and its indexes are deleted
+func (ob *ObjectBuilder) AfterDelete(hook Hook) *ObjectBuilder {
+	ob.mux.Lock()
+	ob.object.hooks.afterDelete = append(ob.object.hooks.afterDelete, hook)
+	ob.mux.Unlock()
+
+	return ob
+}
+
+// runHooks calls the hooks, promises returned by hooks are enqueued after the current promise
+func (o *Object) runHooks(p *Promise, list []Hook, oldObject, input *Struct) error {
+	if len(list) == 0 {
+		return nil
+	}
+	tr := &Transaction{db: o.db}
+	tr.initWrite(p.tr)
+	oldPtr := o.objectPtr(oldObject)
+	newPtr := o.objectPtr(input)
+	for _, hook := range list {
+		promise, err := hook(tr, oldPtr, newPtr)
+		if err != nil {
+			return err
+		}
+		if promise != nil {
+			p.enqueue(promise)
+		}
+	}
+	return nil
+}
+
+// beforeWrite calls BeforeWrite hooks, input is copied if hooks could not change it
+func (o *Object) beforeWrite(p *Promise, input, oldObject *Struct) (*Struct, error) {
+	if len(o.hooks.beforeWrite) == 0 {
+		return input, nil
+	}
+	if !input.value.CanAddr() {
+		value := reflect.New(o.reflectType).Elem()
+		value.Set(input.value)
+		input = &Struct{value: value, editable: true}
+	}
+	return input, o.runHooks(p, o.hooks.beforeWrite, oldObject, input)
+}
+
+// checkedWrites reports if writes of the object should go through hooks, defaults and validation
+func (o *Object) checkedWrites() bool {
+	return len(o.hooks.beforeWrite) > 0 || len(o.hooks.afterWrite) > 0 || len(o.ruledFields) > 0 || len(o.validators) > 0
+}
+
+// objectPtr returns pointer to the object of the struct, nil if struct is not set
+func (o *Object) objectPtr(s *Struct) interface{} {
+	if s == nil {
+		return nil
+	}
+	if s.value.CanAddr() {
+		return s.value.Addr().Interface()
+	}
+	ptr := reflect.New(o.reflectType)
+	ptr.Elem().Set(s.value)
+	return ptr.Interface()
+}
@@ -26,6 +26,7 @@ type Index struct {
 	fields       []*Field
 	handle       func(interface{}) KeyTuple
 	checkHandler func(obj interface{}) bool
+	conditions   []condition // declarative conditions of partial index
 }
 
 // IndexOption is in option struct which allow to set differnt options
@@ -43,6 +44,53 @@ func (i *Index) isEmpty(input *Struct) bool {
 	return true
 }
 
+// hasNull checks if any of the nullable index fields is unset, such objects are not unique indexed
+func (i *Index) hasNull(input *Struct) bool {
+	for _, field := range i.fields {
+		if field.nullable() && field.isNull(input.Get(field)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Where makes the index partial: only objects matching all the conditions will be indexed.
+// Conditions are stored inside the scheme, unlike CheckHandler
+func (i *Index) Where(fieldName string, op Operator, value interface{}) *Index {
+	i.conditions = append(i.conditions, newCondition(i.object, fieldName, op, value))
+	return i
+}
+
+// matches checks if object should be presented inside the index
+func (i *Index) matches(input *Struct) bool {
+	if i.checkHandler != nil && !i.checkHandler(input.value.Interface()) {
+		return false
+	}
+	for k := range i.conditions {
+		if !i.conditions[k].match(input) {
+			return false
+		}
+	}
+	return true
+}
+
+// dependsOn returns fields the index key depends on, handlers are not taken into account
+func (i *Index) dependsOn() []*Field {
+	fields := append([]*Field{}, i.fields...)
+	for _, cond := range i.conditions {
+		fields = append(fields, cond.field)
+	}
+	return fields
+}
+
+// writeKey returns index key the object should be written with, nil if object should not be indexed
+func (i *Index) writeKey(input *Struct) tuple.Tuple {
+	if !i.matches(input) {
+		return nil
+	}
+	return i.getKey(input)
+}
+
 // getKey will return index tuple
 func (i *Index) getKey(input *Struct) (key tuple.Tuple) {
 	if i.handle != nil {
@@ -97,32 +145,27 @@ func (i *Index) getOldKey(tr fdb.Transaction, primaryTuple tuple.Tuple, oldObjec
 		if err != nil {
 			return nil, err
 		}
+		if len(bites) == 0 { // object was not indexed
+			return nil, nil
+		}
 		oldKey, err := tuple.Unpack(bites)
 		if err != nil {
 			return nil, err
 		}
 		return oldKey, nil
 	}
-	return i.getKey(oldObject), nil
+	return i.writeKey(oldObject), nil
 }
 
 // writeSearch will set new index keys and delete old ones for text search index
 func (i *Index) writeSearch(tr fdb.Transaction, primaryTuple tuple.Tuple, input, oldObject *Struct) error {
 	newWords := searchGetInputWords(i, input)
 	toAddWords := map[string]bool{}
-	skip := false
-	if i.checkHandler != nil {
-		if !i.checkHandler(input.value.Interface()) {
-			//fmt.Println("skipping index")
-			skip = true
-		}
-		// old value is better to delete any way
-	}
-	if !skip {
+	// old value is better to delete any way
+	if i.matches(input) {
 		for _, word := range newWords {
 			toAddWords[word] = true
 		}
-		fmt.Println("index words >>", newWords)
 	}
 	toDeleteWords := map[string]bool{}
 	if oldObject != nil {
@@ -140,7 +183,6 @@ func (i *Index) writeSearch(tr fdb.Transaction, primaryTuple tuple.Tuple, input,
 	for word := range toAddWords {
 		key := tuple.Tuple{word}
 		fullKey := append(key, primaryTuple...)
-		fmt.Println("write search key", fullKey, "packed", i.dir.Pack(fullKey))
 		tr.Set(i.dir.Pack(fullKey), []byte{})
 	}
 	for word := range toDeleteWords {
@@ -156,7 +198,7 @@ func (i *Index) Write(tr fdb.Transaction, primaryTuple tuple.Tuple, input, oldOb
 	if i.search {
 		return i.writeSearch(tr, primaryTuple, input, oldObject)
 	}
-	key := i.getKey(input)
+	key := i.writeKey(input)
 	if oldObject != nil {
 		toDelete, err := i.getOldKey(tr, primaryTuple, oldObject)
 		if err != nil { // if error fetching old index - throw it right here
@@ -167,11 +209,17 @@ func (i *Index) Write(tr fdb.Transaction, primaryTuple tuple.Tuple, input, oldOb
 				return nil
 			}
 			i.Delete(tr, primaryTuple, toDelete)
+			if key == nil && i.needValueStore() {
+				tr.Clear(i.valueDir.Pack(primaryTuple))
+			}
 		}
 	}
 	if i.optional && i.isEmpty(input) { // no need to delete any inex than
 		return nil
 	}
+	if i.Unique && i.hasNull(input) { // any number of objects could have unset value
+		return nil
+	}
 	// nil means should not index this object
 	if key == nil {
 		return nil
@@ -218,7 +266,8 @@ func (i *Index) Delete(tr fdb.Transaction, primaryTuple tuple.Tuple, key tuple.T
 	}
 }
 
-func (i *Index) getIterator(tr fdb.ReadTransaction, q *Query) (subspace.Subspace, *fdb.RangeIterator) {
+// getRange returns range of index keys selected by the query
+func (i *Index) getRange(q *Query) (subspace.Subspace, fdb.KeyRange) {
 	if i.Unique {
 		i.object.panic("index is unique (lists not supported)")
 	}
@@ -240,9 +289,20 @@ func (i *Index) getIterator(tr fdb.ReadTransaction, q *Query) (subspace.Subspace
 			}
 		}
 	}
+	return sub, fdb.KeyRange{Begin: start, End: end}
+}
 
-	r := fdb.KeyRange{Begin: start, End: end}
-	rangeResult := tr.GetRange(r, fdb.RangeOptions{Mode: fdb.StreamingModeWantAll, Limit: q.limit, Reverse: q.reverse})
+func (i *Index) getIterator(tr fdb.ReadTransaction, q *Query) (subspace.Subspace, *fdb.RangeIterator) {
+	sub, r := i.getRange(q)
+	r, ok := resumeRange(r, q.resume, q.reverse)
+	if !ok {
+		r.Begin = r.End
+	}
+	limit := q.limit
+	if limit != 0 {
+		limit++ // extra row shows if the cursor is needed
+	}
+	rangeResult := tr.GetRange(r, fdb.RangeOptions{Mode: fdb.StreamingModeWantAll, Limit: limit, Reverse: q.reverse})
 	iterator := rangeResult.Iterator()
 	return sub, iterator
 }
@@ -253,11 +313,18 @@ func (i *Index) getList(tr fdb.ReadTransaction, q *Query) ([]*needObject, error)
 
 	primaryLen := len(i.object.primaryFields)
 	values := []*needObject{}
+	var lastKey fdb.Key
 	for iterator.Advance() {
 		kv, err := iterator.Get()
 		if err != nil {
 			return nil, err
 		}
+		if q.limit != 0 && len(values) == q.limit {
+			q.next.cursor = lastKey
+			break
+		}
+		lastKey = kv.Key
+		q.stats.read(kv)
 
 		fullTuple, err := sub.Unpack(kv.Key)
 		if err != nil {
@@ -268,7 +335,7 @@ func (i *Index) getList(tr fdb.ReadTransaction, q *Query) ([]*needObject, error)
 		}
 		key := fullTuple[len(fullTuple)-primaryLen:]
 
-		values = append(values, i.object.need(tr, i.object.sub(key)))
+		values = append(values, q.need(tr, key))
 	}
 	return values, nil
 }
@@ -279,11 +346,18 @@ func (i *Index) getPrimariesList(tr fdb.ReadTransaction, q *Query) (*Slice, erro
 
 	primaryLen := len(i.object.primaryFields)
 	values := []*Value{}
+	var lastKey fdb.Key
 	for iterator.Advance() {
 		kv, err := iterator.Get()
 		if err != nil {
 			return nil, err
 		}
+		if q.limit != 0 && len(values) == q.limit {
+			q.next.cursor = lastKey
+			break
+		}
+		lastKey = kv.Key
+		q.stats.read(kv)
 		fullTuple, err := sub.Unpack(kv.Key)
 		if err != nil {
 			return nil, err
@@ -406,6 +480,81 @@ func (i *Index) Reindex() {
 	}
 }
 
+// isIndexed checks if index data for the object presented
+func (i *Index) isIndexed(tr fdb.ReadTransaction, primaryTuple tuple.Tuple, input *Struct) (bool, error) {
+	key := i.getKey(input)
+	if key == nil {
+		return false, nil
+	}
+	if i.Unique {
+		primaryBytes, err := tr.Get(i.dir.Pack(key)).Get()
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(primaryBytes, primaryTuple.Pack()), nil
+	}
+	fullKey := append(tuple.Tuple{}, key...)
+	fullKey = append(fullKey, primaryTuple...)
+	row, err := tr.Get(i.dir.Pack(fullKey)).Get()
+	if err != nil {
+		return false, err
+	}
+	return row != nil, nil
+}
+
+// shouldIndex checks if the object should be presented inside the index
+func (i *Index) shouldIndex(input *Struct) bool {
+	if i.optional && i.isEmpty(input) {
+		return false
+	}
+	if i.Unique && i.hasNull(input) {
+		return false
+	}
+	return i.writeKey(input) != nil
+}
+
+// Verify will check index consistency: every object matching the index should be indexed, objects not
+// matching partial index conditions, with empty optional or null unique values should not.
+// Returns primaries of inconsistent objects
+func (i *Index) Verify() ([]tuple.Tuple, error) {
+	if i.search {
+		i.object.panic("index «" + i.Name + "» is search index (verify not supported)")
+	}
+	object := i.object
+	query := object.ListAll().Limit(100)
+	inconsistent := []tuple.Tuple{}
+	for query.Next() {
+		slice := query.Slice()
+		if slice.err != nil {
+			return inconsistent, slice.err
+		}
+		res, err := object.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+			primaries := []tuple.Tuple{}
+			for _, value := range slice.values {
+				obj, err := value.Reflect()
+				if err != nil {
+					return nil, err
+				}
+				input := structAny(obj.Interface())
+				primaryTuple := input.getPrimary(object)
+				indexed, err := i.isIndexed(tr, primaryTuple, input)
+				if err != nil {
+					return nil, err
+				}
+				if indexed != i.shouldIndex(input) {
+					primaries = append(primaries, primaryTuple)
+				}
+			}
+			return primaries, nil
+		})
+		if err != nil {
+			return inconsistent, err
+		}
+		inconsistent = append(inconsistent, res.([]tuple.Tuple)...)
+	}
+	return inconsistent, nil
+}
+
 // SetOption allow to set option
 func (i *Index) SetOption(option IndexOption) {
 	if option.CheckHandler != nil {
@@ -31,7 +31,9 @@ func (is *IndexSearch) Search(name string) *PromiseSlice {
 			limit = p.limit
 		}
 		rangeResults := map[string]fdb.RangeResult{}
-		for _, word := range words {
+		scope := "search:" + i.Name
+		var bounds fdb.KeyRange
+		for k, word := range words {
 			partword := i.dir.Pack(tuple.Tuple{word})
 			start := partword[:len(partword)-1]
 			end := make(fdb.Key, len(start))
@@ -41,8 +43,24 @@ func (is *IndexSearch) Search(name string) *PromiseSlice {
 			end = append(end, 255)
 
 			r := fdb.KeyRange{Begin: start, End: end}
+			if k == wordsLen-1 { // results are ordered by the last word, cursor continues it
+				bounds = r
+				var ok bool
+				var err error
+				r, ok, err = p.resumeRange(scope, bounds)
+				if err != nil {
+					return p.fail(err)
+				}
+				if !ok {
+					r.Begin = r.End
+				}
+			}
+			wordLimit := limit
+			if k == wordsLen-1 && limit != 0 {
+				wordLimit++ // extra row shows if the cursor is needed
+			}
 			rangeResults[word] = p.readTr.GetRange(r, fdb.RangeOptions{
-				Limit:   limit,
+				Limit:   wordLimit,
 				Reverse: p.reverse,
 			})
 		}
@@ -50,11 +68,15 @@ func (is *IndexSearch) Search(name string) *PromiseSlice {
 		slice := Slice{}
 		return func() Chain {
 			found := map[string]int{}
-			for _, word := range words {
+			for k, word := range words {
 				rows, err := rangeResults[word].GetSliceWithError()
 				if err != nil {
 					return p.fail(err)
 				}
+				if k == wordsLen-1 && limit != 0 && len(rows) > limit {
+					rows = rows[:limit]
+					p.cursor = newCursor(scope, bounds, p.reverse, rows[len(rows)-1].Key)
+				}
 				for _, row := range rows {
 					fullTuple, err := i.dir.Unpack(row.Key)
 					if err != nil {
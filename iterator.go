@@ -0,0 +1,174 @@
+package stored
+
+import (
+	"errors"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+// ErrSnapshotTooOld returned by Iterator in snapshot mode when scan does not fit into lifetime
+// of the read version
+var ErrSnapshotTooOld = errors.New("Snapshot read version is too old")
+
+// transactionTooOld is FoundationDB error code of expired read version
+const transactionTooOld = 1007
+
+// Iterator streams objects of the query fetching them by batches, each batch is fetched
+// within its own read transaction
+type Iterator struct {
+	query    *Query
+	batch    int
+	snapshot bool
+	version  int64 // read version pinned in snapshot mode
+	values   []*Value
+	current  *Value
+	fetched  int
+	resume   fdb.Key
+	started  bool
+	finished bool
+	err      error
+}
+
+// Iter returns iterator streaming all objects of the query, Limit sets total number of objects
+func (q *Query) Iter() *Iterator {
+	if q.onlyPrimary {
+		q.object.panic("Iter could not be combined with OnlyPrimary")
+	}
+	return &Iterator{
+		query: q,
+		batch: 100,
+	}
+}
+
+// Batch sets number of objects fetched within one transaction
+func (it *Iterator) Batch(size int) *Iterator {
+	if size < 1 {
+		it.query.object.panic("iterator batch size should be positive")
+	}
+	it.batch = size
+	return it
+}
+
+// Snapshot makes all batches read at the read version of the first one, so iterator returns consistent
+// snapshot of the data. Scan should fit into lifetime of the read version (5 seconds), otherwise
+// ErrSnapshotTooOld is returned
+func (it *Iterator) Snapshot() *Iterator {
+	it.snapshot = true
+	return it
+}
+
+// Next moves iterator to the next object, returns false once all objects are scanned or error happened
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	q := it.query
+	if q.limit != 0 && it.fetched >= q.limit {
+		return false
+	}
+	for len(it.values) == 0 {
+		if it.finished {
+			return false
+		}
+		it.err = it.fetch()
+		if it.err != nil {
+			return false
+		}
+	}
+	it.current = it.values[0]
+	it.values = it.values[1:]
+	it.fetched++
+	return true
+}
+
+// fetch loads the next batch of objects
+func (it *Iterator) fetch() error {
+	q := it.query
+	if !it.started {
+		it.started = true
+		err := q.applyAfter()
+		if err != nil {
+			return err
+		}
+		it.resume = q.resume
+	}
+	page := *q
+	page.resume = it.resume
+	page.limit = it.batch
+	if q.limit != 0 && q.limit-it.fetched < page.limit {
+		page.limit = q.limit - it.fetched
+	}
+	page.next.cursor = nil
+
+	p := q.object.promiseSlice()
+	p.doRead(func() Chain {
+		return page.executePlan(p, page.getPlan())
+	})
+	var err error
+	if it.snapshot {
+		err = it.transactSnapshot(&p.Promise)
+	} else {
+		_, err = p.transact()
+	}
+	if err != nil {
+		return err
+	}
+	it.values = p.resp.(*Slice).values
+	it.resume = page.next.cursor
+	if it.resume == nil {
+		it.finished = true
+	}
+	return nil
+}
+
+// transactSnapshot executes the promise at pinned read version
+func (it *Iterator) transactSnapshot(p *Promise) error {
+	tr, err := it.query.object.db.CreateTransaction()
+	if err != nil {
+		return err
+	}
+	for {
+		if it.version == 0 {
+			it.version, err = tr.GetReadVersion().Get()
+			if err != nil {
+				return err
+			}
+		} else {
+			tr.SetReadVersion(it.version)
+		}
+		p.readTr = tr.Snapshot()
+		_, err = p.transact()
+		if err == nil {
+			return nil
+		}
+		fdbErr, ok := err.(fdb.Error)
+		if !ok {
+			return err
+		}
+		if fdbErr.Code == transactionTooOld {
+			return ErrSnapshotTooOld
+		}
+		err = tr.OnError(fdbErr).Get()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Scan fills the passed object with the current object of the iterator
+func (it *Iterator) Scan(objectPtr interface{}) error {
+	if it.current == nil {
+		return ErrNotFound
+	}
+	return it.current.Scan(objectPtr)
+}
+
+// Value returns current object of the iterator
+func (it *Iterator) Value() *Value {
+	return it.current
+}
+
+// Err returns error happened while scanning
+func (it *Iterator) Err() error {
+	return it.err
+}
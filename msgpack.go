@@ -1,12 +1,76 @@
 package stored
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 
 	"github.com/vmihailenco/msgpack/v5"
 )
 
+// FieldsEncoder is implemented by objects with code generated by cmd/stored. Generated methods encode
+// and decode fields without reflection, false is returned for fields the generator does not support
+type FieldsEncoder interface {
+	StoredEncodeField(name string, enc *msgpack.Encoder) (bool, error)
+	StoredDecodeField(name string, dec *msgpack.Decoder) (bool, error)
+}
+
+// fieldsEncoder returns generated encoder of the object, nil if there is no generated code
+func fieldsEncoder(value reflect.Value) FieldsEncoder {
+	if !value.CanAddr() {
+		return nil
+	}
+	encoder, _ := value.Addr().Interface().(FieldsEncoder)
+	return encoder
+}
+
+// encodeGenerated packs fields as msgpack map using generated encoder, the same way reflection does
+func encodeGenerated(encoder FieldsEncoder, value reflect.Value, fields map[string]*Field) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	err := enc.EncodeMapLen(len(fields))
+	if err != nil {
+		return nil, err
+	}
+	for fieldName, field := range fields {
+		err = enc.EncodeString(fieldName)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := encoder.StoredEncodeField(fieldName, enc)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			packed, err := field.packValue(value.Field(field.Num))
+			if err != nil {
+				return nil, err
+			}
+			err = enc.Encode(packed)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeGeneratedField encodes single field using generated encoder
+func encodeGeneratedField(encoder FieldsEncoder, fieldName string) ([]byte, bool) {
+	var buf bytes.Buffer
+	ok, err := encoder.StoredEncodeField(fieldName, msgpack.NewEncoder(&buf))
+	if !ok || err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decodeGeneratedField decodes single field using generated decoder
+func decodeGeneratedField(encoder FieldsEncoder, fieldName string, data []byte) bool {
+	ok, err := encoder.StoredDecodeField(fieldName, msgpack.NewDecoder(bytes.NewReader(data)))
+	return ok && err == nil
+}
+
 // checkNilPtrObject check if obj is Nil reflect.Ptr
 // If yes, initializes underlying object and return it
 func checkNilPtrObject(obj reflect.Value) reflect.Value {
@@ -97,13 +161,13 @@ func setMsgPackMapObject(mapObject reflect.Value, value interface{}) {
 }
 
 // setMsgPackObjectGround is like setMsgPackObject but when field is predestemined
-func setMsgPackObjectGround(field *Field, obj reflect.Value, value interface{}) {
-	for {
-		if field.Kind != reflect.Ptr {
-			break
-		}
-
-		obj = checkNilPtrObject(obj)
+func setMsgPackObjectGround(field *Field, obj reflect.Value, value interface{}) error {
+	if val := reflect.ValueOf(value); val.IsValid() && val.Type().AssignableTo(obj.Type()) {
+		obj.Set(val) // time.Time and values decoded by field codecs
+		return nil
+	}
+	if field.nullable() {
+		return field.setPacked(obj, value)
 	}
 
 	switch field.Kind {
@@ -149,10 +213,15 @@ func setMsgPackObjectGround(field *Field, obj reflect.Value, value interface{})
 		fmt.Println("fieldKIND", field.Kind, "name", field.Name, objType, value)
 		obj.Set(reflect.ValueOf(value).Convert(objType))
 	}
+	return nil
 }
 
 // setMsgPackObject setting obj from value with attempt to cast it to field type
 func setMsgPackObject(obj reflect.Value, value interface{}) {
+	if val := reflect.ValueOf(value); val.IsValid() && val.Type().AssignableTo(obj.Type()) {
+		obj.Set(val)
+		return
+	}
 	for {
 		if obj.Kind() != reflect.Ptr {
 			break
@@ -178,12 +247,17 @@ func setMsgPackObject(obj reflect.Value, value interface{}) {
 	}
 }
 
-func fillObjectImmutableFields(o *Object, value reflect.Value, data []byte) {
+func fillObjectImmutableFields(o *Object, value reflect.Value, data []byte, fields map[string]bool) error {
+	if len(data) > 0 && data[0] == codecMarker {
+		return o.unpackFields(value, data, fields)
+	}
+	if encoder := fieldsEncoder(value); fields != nil || encoder != nil {
+		return fillObjectSelectedFields(o, value, data, fields, encoder)
+	}
 	combinedFields := map[string]interface{}{}
 	err := msgpack.Unmarshal(data, &combinedFields)
 	if err != nil {
-		fmt.Println("Fill failed:", err)
-		return
+		return err
 	}
 
 	for fieldName, fieldData := range combinedFields {
@@ -191,9 +265,56 @@ func fillObjectImmutableFields(o *Object, value reflect.Value, data []byte) {
 		if fok {
 			fieldObj := value.Field(field.Num)
 
-			setMsgPackObject(fieldObj, fieldData)
+			err = field.setPacked(fieldObj, fieldData)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fillObjectSelectedFields decodes only selected entries of packed immutable fields, skipping others.
+// All the fields are selected when fields is nil, generated decoder is used when passed
+func fillObjectSelectedFields(o *Object, value reflect.Value, data []byte, fields map[string]bool, encoder FieldsEncoder) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	n, err := dec.DecodeMapLen()
+	if err != nil {
+		return err
+	}
+	for k := 0; k < n; k++ {
+		fieldName, err := dec.DecodeString()
+		if err != nil {
+			return err
+		}
+		field, fok := o.immutableFields[fieldName]
+		if !fok || (fields != nil && !fields[fieldName]) {
+			err = dec.Skip()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if encoder != nil {
+			ok, err := encoder.StoredDecodeField(fieldName, dec)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+		}
+		var fieldData interface{}
+		err = dec.Decode(&fieldData)
+		if err != nil {
+			return err
+		}
+		err = field.setPacked(value.Field(field.Num), fieldData)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
 }
 
 func GetPlus(kind reflect.Kind) []byte {
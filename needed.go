@@ -1,14 +1,20 @@
 package stored
 
 import (
+	"bytes"
+
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
 )
 
 type needObject struct {
 	object      *Object
 	rangeResult fdb.RangeResult
 	subspace    subspace.Subspace
+	fields      map[string]bool // selected fields, only keys of these fields are fetched
+	exists      fdb.FutureKey
+	keys        map[string]fdb.FutureByteSlice
 }
 
 func (n *needObject) need(tr fdb.ReadTransaction, sub subspace.Subspace) {
@@ -24,7 +30,29 @@ func (n *needObject) need(tr fdb.ReadTransaction, sub subspace.Subspace) {
 	n.rangeResult = tr.GetRange(r, fdb.RangeOptions{Mode: fdb.StreamingModeWantAll})
 }
 
+// needFields requests only keys of selected fields and the first key of the object to check it exists
+func (n *needObject) needFields(tr fdb.ReadTransaction, sub subspace.Subspace, fields []*Field) {
+	n.fields = n.object.selection(fields)
+	n.keys = map[string]fdb.FutureByteSlice{}
+	n.exists = tr.GetKey(fdb.FirstGreaterOrEqual(sub.FDBKey()))
+	for _, field := range fields {
+		if field.primary {
+			continue
+		}
+		keyName := field.Name
+		if !field.mutable {
+			keyName = "*"
+		}
+		if _, ok := n.keys[keyName]; !ok {
+			n.keys[keyName] = tr.Get(sub.Pack(tuple.Tuple{keyName}))
+		}
+	}
+}
+
 func (n *needObject) fetch() (*Value, error) {
+	if n.fields != nil {
+		return n.fetchFields()
+	}
 	rows, err := n.rangeResult.GetSliceWithError()
 	if err != nil {
 		return nil, err
@@ -37,3 +65,29 @@ func (n *needObject) fetch() (*Value, error) {
 	value.FromKeyValue(n.subspace, rows)
 	return &value, nil
 }
+
+func (n *needObject) fetchFields() (*Value, error) {
+	key, err := n.exists.Get()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(key, n.subspace.FDBKey()) {
+		return nil, ErrNotFound
+	}
+	value := Value{object: n.object, raw: valueRaw{}, fields: n.fields}
+	for keyName, future := range n.keys {
+		bytes, err := future.Get()
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes) > 0 {
+			value.raw[keyName] = bytes
+		}
+	}
+	keysTuple, err := n.object.primary.Unpack(n.subspace.FDBKey())
+	if err != nil {
+		return nil, err
+	}
+	value.fromKeyTuple(keysTuple)
+	return &value, nil
+}
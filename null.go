@@ -0,0 +1,151 @@
+package stored
+
+import (
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+// Null is the value which could be unset, unlike pointer it does not require allocation. Unset values
+// are stored with null marker, they are not indexed by optional and unique indexes
+type Null[T any] struct {
+	Value T
+	Valid bool
+}
+
+// NullOf returns Null with the value set
+func NullOf[T any](value T) Null[T] {
+	return Null[T]{Value: value, Valid: true}
+}
+
+// Ptr returns pointer to the value, nil if value is unset
+func (n Null[T]) Ptr() *T {
+	if !n.Valid {
+		return nil
+	}
+	value := n.Value
+	return &value
+}
+
+// EncodeMsgpack encodes unset value as nil
+func (n Null[T]) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if !n.Valid {
+		return enc.EncodeNil()
+	}
+	return enc.Encode(n.Value)
+}
+
+// DecodeMsgpack decodes nil as unset value
+func (n *Null[T]) DecodeMsgpack(dec *msgpack.Decoder) error {
+	code, err := dec.PeekCode()
+	if err != nil {
+		return err
+	}
+	if code == msgpcode.Nil {
+		*n = Null[T]{}
+		return dec.DecodeNil()
+	}
+	n.Valid = true
+	return dec.Decode(&n.Value)
+}
+
+func (n Null[T]) nullValue() {}
+
+// nullType is implemented by Null of any type
+type nullType interface {
+	nullValue()
+}
+
+var typeOfNull = reflect.TypeOf((*nullType)(nil)).Elem()
+
+// msgpackNil is the marker of null value
+var msgpackNil = []byte{0xc0}
+
+// nullable checks if field could be unset: pointers and Null
+func (f *Field) nullable() bool {
+	return f.codec == codecPointer || f.codec == codecNull
+}
+
+// initElem creates description of the type nullable field wraps
+func (f *Field) initElem() {
+	if !f.nullable() {
+		return
+	}
+	var elemType reflect.Type
+	if f.codec == codecNull {
+		elemType = f.Type.Type.Field(0).Type
+	} else {
+		elemType = f.Type.Type.Elem()
+	}
+	elem := *f
+	elem.Type.Type = elemType
+	elem.Kind = elemType.Kind()
+	elem.codec = codecOf(elemType)
+	elem.mutable = false // native encoding is not used for nullable numbers
+	f.elem = &elem
+	f.elem.initElem()
+}
+
+// isNull checks if value of the field is unset
+func (f *Field) isNull(val interface{}) bool {
+	if val == nil {
+		return true
+	}
+	value := reflect.ValueOf(val)
+	if value.Type() != f.Type.Type {
+		return false // value of wrapped type
+	}
+	if f.codec == codecPointer {
+		return value.IsNil()
+	}
+	return !value.Field(1).Bool()
+}
+
+// unwrap returns value wrapped by pointer or Null, value of wrapped type is returned as is
+func (f *Field) unwrap(val interface{}) interface{} {
+	value := reflect.ValueOf(val)
+	if value.Type() != f.Type.Type {
+		return val
+	}
+	if f.codec == codecPointer {
+		return value.Elem().Interface()
+	}
+	return value.Field(0).Interface()
+}
+
+// wrap returns pointer or Null with the value set
+func (f *Field) wrap(value reflect.Value) reflect.Value {
+	if value.Type() != f.elem.Type.Type {
+		value = value.Convert(f.elem.Type.Type)
+	}
+	if f.codec == codecPointer {
+		ptr := reflect.New(f.elem.Type.Type)
+		ptr.Elem().Set(value)
+		return ptr
+	}
+	res := reflect.New(f.Type.Type).Elem()
+	res.Field(0).Set(value)
+	res.Field(1).SetBool(true)
+	return res
+}
+
+// decodeNullable decodes value of nullable field stored inside the field key
+func (f *Field) decodeNullable(data []byte) (reflect.Value, error) {
+	if len(data) == 0 || (len(data) == 1 && data[0] == msgpackNil[0]) {
+		return reflect.Zero(f.Type.Type), nil
+	}
+	if f.elem.codec.custom() || f.elem.nullable() {
+		value, err := f.elem.ToInterface(data)
+		if err != nil {
+			return reflect.Zero(f.Type.Type), err
+		}
+		return f.wrap(reflect.ValueOf(value)), nil
+	}
+	ptr := reflect.New(f.elem.Type.Type)
+	err := msgpack.Unmarshal(data, ptr.Interface())
+	if err != nil {
+		return reflect.Zero(f.Type.Type), err
+	}
+	return f.wrap(ptr.Elem()), nil
+}
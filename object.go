@@ -9,7 +9,7 @@ import (
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
-	"github.com/vmihailenco/msgpack"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 // Object is an abstraction for working with objects
@@ -30,6 +30,12 @@ type Object struct {
 	counters        map[string]*Counter
 	Relations       []*Relation
 	keysCount       int
+	schemeVersion   uint64           // latest version of the scheme
+	codec           Codec            // codec of packed fields, msgpack if not set
+	codecs          map[uint64]Codec // codecs of previous scheme versions to read old rows
+	ruledFields     []*Field         // fields with validation rules or default values
+	validators      []func(obj interface{}) error
+	hooks           hooks
 }
 
 func (o *Object) init() {
@@ -125,7 +131,7 @@ func (o *Object) getPrimaryTuple(objOrID interface{}) tuple.Tuple {
 	}
 	res := tuple.Tuple{}
 
-	if kind == reflect.Struct {
+	if kind == reflect.Struct && !object.Type().Implements(typeOfNull) {
 		for _, field := range o.primaryFields {
 			row := object.Field(field.Num)
 			res = append(res, field.tupleElement(row.Interface()))
@@ -138,7 +144,12 @@ func (o *Object) getPrimaryTuple(objOrID interface{}) tuple.Tuple {
 			o.panic("primary key should be set")
 		}
 		field := o.primaryFields[0]
-		if kind != field.Kind {
+		if field.nullable() {
+			if field.isNull(objOrID) {
+				o.panic("primary key could not be null")
+			}
+			objOrID = field.elem.tupleElement(field.unwrap(objOrID))
+		} else if kind != field.Kind {
 			o.panic("primary key type does not matched with passed one")
 		}
 		res = append(res, objOrID)
@@ -155,7 +166,21 @@ func (o *Object) getPrimaryField() *Field {
 	return o.field(o.primaryKey)
 }
 
-func (o *Object) doWrite(tr fdb.Transaction, sub subspace.Subspace, primaryTuple tuple.Tuple, input, oldObject *Struct, addNew bool) error {
+func (o *Object) doWrite(p *Promise, sub subspace.Subspace, primaryTuple tuple.Tuple, input, oldObject *Struct, addNew bool) error {
+	tr := p.tr
+	input, err := o.beforeWrite(p, input, oldObject)
+	if err != nil {
+		return err
+	}
+	input, err = o.prepare(input)
+	if err != nil {
+		return err
+	}
+	for _, el := range primaryTuple {
+		if el == nil {
+			return ErrNullPrimary
+		}
+	}
 	if addNew {
 		for _, ctr := range o.counters {
 			ctr.increment(tr, input)
@@ -181,7 +206,10 @@ func (o *Object) doWrite(tr fdb.Transaction, sub subspace.Subspace, primaryTuple
 		fieldsWritten++
 	}
 
-	immutablesValue := input.GetImmutableFieldsBytes(o.immutableFields)
+	immutablesValue, err := o.packFields(input)
+	if err != nil {
+		return err
+	}
 	if immutablesValue != nil {
 		tr.Set(sub.Pack(tuple.Tuple{"*"}), immutablesValue)
 		fieldsWritten++
@@ -196,11 +224,10 @@ func (o *Object) doWrite(tr fdb.Transaction, sub subspace.Subspace, primaryTuple
 		//fmt.Println("WRITE index", primaryTuple, input)
 		err := index.Write(tr, primaryTuple, input, oldObject)
 		if err != nil {
-			panic(fmt.Sprintln("INDEX WRITE ERROR", index.Name, err))
 			return err
 		}
 	}
-	return nil
+	return o.runHooks(p, o.hooks.afterWrite, oldObject, input)
 }
 
 func (o *Object) promise() *Promise {
@@ -267,7 +294,7 @@ func (o *Object) Write(data interface{}) *PromiseErr {
 			}
 			object := structAny(value.Interface())
 
-			err = o.doWrite(p.tr, sub, primaryTuple, input, object, false)
+			err = o.doWrite(p.self(), sub, primaryTuple, input, object, false)
 			if err != nil {
 				return p.fail(err)
 			}
@@ -301,8 +328,7 @@ func (o *Object) Update(data interface{}, callback func() error) *PromiseErr {
 			if err != nil {
 				return p.fail(err)
 			}
-			input.Fill(o, value)
-			err = value.Err()
+			err = input.Fill(o, value)
 			if err != nil {
 				return p.fail(err)
 			}
@@ -312,7 +338,7 @@ func (o *Object) Update(data interface{}, callback func() error) *PromiseErr {
 			if err != nil {
 				return p.fail(err)
 			}
-			err = o.doWrite(p.tr, sub, primaryTuple, input, oldObject, false)
+			err = o.doWrite(p.self(), sub, primaryTuple, input, oldObject, false)
 			if err != nil {
 				return p.fail(err)
 			}
@@ -352,9 +378,9 @@ func (o *Object) Set(objectPtr interface{}) *PromiseErr {
 				addNew = true
 			}
 
-			err = o.doWrite(p.tr, sub, primaryTuple, input, oldObject, addNew)
+			err = o.doWrite(p.self(), sub, primaryTuple, input, oldObject, addNew)
 			if err != nil {
-				p.fail(err)
+				return p.fail(err)
 			}
 
 			return p.ok()
@@ -374,62 +400,113 @@ func (o *Object) incFieldUnsafeByTuple(p *Promise, primaryTuple tuple.Tuple, fie
 	sub := o.primary.Sub(primaryTuple...)
 
 	if field.mutable {
-		val, err := field.ToBytes(incVal)
+		return o.incStored(p, sub.Pack(tuple.Tuple{field.Name}), field, incVal, p.ok)
+	}
+	immutableFieldsKey := sub.Pack(tuple.Tuple{"*"})
+	futureKey := p.tr.Get(immutableFieldsKey)
+
+	return func() Chain {
+		allData, err := futureKey.Get()
 		if err != nil {
 			return p.fail(err)
 		}
-		incKey := sub.Pack(tuple.Tuple{field.Name})
-		p.tr.Add(incKey, val)
-
-	} else {
-		immutableFieldsKey := sub.Pack(tuple.Tuple{"*"})
-		futureKey := p.tr.Get(immutableFieldsKey)
-
-		return func() Chain {
-			allData, err := futureKey.Get()
-			if err != nil {
-				return p.fail(err)
-			}
-			immutableFields := map[string]interface{}{}
-			err = msgpack.Unmarshal(allData, &immutableFields)
+		if !o.plainPacked(allData) {
+			packedFields, err := o.editPacked(allData, func(value reflect.Value) error {
+				fieldValue := value.Field(field.Num)
+				if isIntKind(fieldValue.Kind()) {
+					fieldValue.SetInt(fieldValue.Int() + incVal)
+				} else if isUintKind(fieldValue.Kind()) {
+					fieldValue.SetUint(fieldValue.Uint() + uint64(incVal))
+				}
+				return nil
+			})
 			if err != nil {
 				return p.fail(err)
 			}
+			p.tr.Set(immutableFieldsKey, packedFields)
+			return p.ok()
+		}
+		immutableFields := map[string]interface{}{}
+		err = msgpack.Unmarshal(allData, &immutableFields)
+		if err != nil {
+			return p.fail(err)
+		}
 
-			switch v := immutableFields[field.Name].(type) {
-			case int:
-				immutableFields[field.Name] = v + int(incVal)
-			case int8:
-				immutableFields[field.Name] = v + int8(incVal)
-			case int64:
-				immutableFields[field.Name] = v + int64(incVal)
-			case int32:
-				immutableFields[field.Name] = v + int32(incVal)
-			case uint:
-				immutableFields[field.Name] = v + uint(incVal)
-			case uint8:
-				immutableFields[field.Name] = v + uint8(incVal)
-			case uint64:
-				immutableFields[field.Name] = v + uint64(incVal)
-			case uint32:
-				immutableFields[field.Name] = v + uint32(incVal)
-			}
-			packedFields, err := msgpack.Marshal(immutableFields)
+		switch v := immutableFields[field.Name].(type) {
+		case int:
+			immutableFields[field.Name] = v + int(incVal)
+		case int8:
+			immutableFields[field.Name] = v + int8(incVal)
+		case int64:
+			immutableFields[field.Name] = v + int64(incVal)
+		case int32:
+			immutableFields[field.Name] = v + int32(incVal)
+		case uint:
+			immutableFields[field.Name] = v + uint(incVal)
+		case uint8:
+			immutableFields[field.Name] = v + uint8(incVal)
+		case uint64:
+			immutableFields[field.Name] = v + uint64(incVal)
+		case uint32:
+			immutableFields[field.Name] = v + uint32(incVal)
+		}
+		packedFields, err := msgpack.Marshal(immutableFields)
+		if err != nil {
+			return p.fail(err)
+		}
+
+		p.tr.Set(immutableFieldsKey, packedFields)
+		return p.ok()
+	}
+}
+
+// incStored increments mutable numeric field. FDB atomic add is used only if the field is atomic and its stored
+// value is 8 byte integer already, otherwise the value is read, incremented and written back
+func (o *Object) incStored(p *Promise, key fdb.Key, field *Field, incVal interface{}, next func() Chain) Chain {
+	inc := reflect.ValueOf(incVal)
+	if !isNumberKind(field.Kind) || !inc.IsValid() || !inc.Type().ConvertibleTo(field.Type.Type) {
+		return p.fail(fmt.Errorf("field «%s» could not be incremented by %v", field.Name, incVal))
+	}
+	inc = inc.Convert(field.Type.Type)
+	current := p.tr.Snapshot().Get(key)
+	return func() Chain {
+		data, err := current.Get()
+		if err != nil {
+			return p.fail(err)
+		}
+		if field.atomic() && len(data) == 8 {
+			p.tr.Add(key, field.nativeBytes(inc))
+			return next()
+		}
+		// value written by msgpack, or missing one, is converted using read-modify-write
+		p.tr.AddReadConflictKey(key)
+		value := reflect.New(field.Type.Type).Elem()
+		if field.isNative(data) {
+			value = field.fromNative(data)
+		} else if len(data) > 0 {
+			current, err := field.ToInterface(data)
 			if err != nil {
 				return p.fail(err)
 			}
-
-			p.tr.Set(immutableFieldsKey, packedFields)
-			return p.ok()
+			stored := reflect.ValueOf(current)
+			if stored.IsValid() && stored.Type().ConvertibleTo(field.Type.Type) {
+				value.Set(stored.Convert(field.Type.Type))
+			}
 		}
+		addNumber(value, inc)
+		data, err = field.valueBytes(value.Interface())
+		if err != nil {
+			return p.fail(err)
+		}
+		p.tr.Set(key, data)
+		return next()
 	}
-
-	return p.ok()
 }
 
 // IncFieldUnsafe increment field  of an object
 // does not implement indexes in the moment
 // would not increment field of passed object, take care
+// write hooks, defaults and validation are not applied, use Atomic instead
 func (o *Object) IncFieldUnsafe(objOrID interface{}, fieldName string, incVal int64) *PromiseErr {
 	//fmt.Println("[STORED] IncFieldUnsafe:", o.name)
 
@@ -444,6 +521,7 @@ func (o *Object) IncFieldUnsafe(objOrID interface{}, fieldName string, incVal in
 
 // IncGetField increment field and return new value
 // moved to IncFieldAtomic
+// write hooks, defaults and validation are not applied
 func (o *Object) IncGetField(objOrID interface{}, fieldName string, incVal interface{}) *Promise {
 	//fmt.Println("[STORED] IncGetField:", o.name)
 
@@ -453,25 +531,23 @@ func (o *Object) IncGetField(objOrID interface{}, fieldName string, incVal inter
 	p.do(func() Chain {
 		sub := o.subspace(objOrID)
 		incKey := sub.Pack(tuple.Tuple{field.Name})
-		val, err := field.ToBytes(incVal)
-		if err != nil {
-			return p.fail(err)
-		}
-		p.tr.Add(incKey, val)
-		fieldGet := p.tr.Get(incKey)
-		return func() Chain {
-			bytes, err := fieldGet.Get()
-			if err != nil {
-				return p.fail(err)
+		return o.incStored(p, incKey, field, incVal, func() Chain {
+			fieldGet := p.tr.Get(incKey)
+			return func() Chain {
+				bytes, err := fieldGet.Get()
+				if err != nil {
+					return p.fail(err)
+				}
+				return p.done(p.getValueField(o, field, bytes))
 			}
-			return p.done(p.getValueField(o, field, bytes))
-		}
+		})
 	})
 	return p
 }
 
 // UpdateField updates object field via callback with old value
 // moved to ChangeField
+// write hooks, defaults and validation are not applied
 func (o *Object) UpdateField(objOrID interface{}, fieldName string, callback func(value interface{}) (interface{}, error)) *Promise {
 	//fmt.Println("[STORED] UpdateField:", o.name)
 
@@ -492,13 +568,17 @@ func (o *Object) UpdateField(objOrID interface{}, fieldName string, callback fun
 				return p.fail(ErrNotFound)
 			}
 
-			newValue, err := callback(field.ToInterface(val))
+			current, err := field.ToInterface(val)
+			if err != nil {
+				return p.fail(err)
+			}
+			newValue, err := callback(current)
 			if err != nil {
 				return p.fail(err)
 			}
 
 			return func() Chain {
-				bytesValue, err := field.ToBytes(newValue)
+				bytesValue, err := field.valueBytes(newValue)
 				if err != nil {
 					return p.fail(err)
 				}
@@ -514,6 +594,26 @@ func (o *Object) UpdateField(objOrID interface{}, fieldName string, callback fun
 				if err != nil {
 					return p.fail(err)
 				}
+				if !o.plainPacked(allData) {
+					packedFields, err := o.editPacked(allData, func(value reflect.Value) error {
+						fieldValue := value.Field(field.Num)
+						newValue, err := callback(fieldValue.Interface())
+						if err != nil {
+							return err
+						}
+						converted := reflect.ValueOf(newValue)
+						if !converted.IsValid() || !converted.Type().ConvertibleTo(fieldValue.Type()) {
+							return fmt.Errorf("value of field «%s» should be %s, got %T", field.Name, fieldValue.Type(), newValue)
+						}
+						fieldValue.Set(converted.Convert(fieldValue.Type()))
+						return nil
+					})
+					if err != nil {
+						return p.fail(err)
+					}
+					p.tr.Set(immutableFieldsKey, packedFields)
+					return p.ok()
+				}
 				immutableFields := map[string]interface{}{}
 				err = msgpack.Unmarshal(allData, &immutableFields)
 				if err != nil {
@@ -569,14 +669,17 @@ func (o *Object) GetField(objectPtr interface{}, fieldName string) *PromiseErr {
 			if len(keyData) == 0 {
 				return p.ok()
 			}
-			input.setField(field, keyData)
+			err = input.setField(field, keyData)
+			if err != nil {
+				return p.fail(err)
+			}
 			return p.ok()
 		}
 	})
 	return p
 }
 
-// SetField sets any value to requested field
+// SetField sets any value to requested field, write hooks, defaults and validation are not applied, use Patch instead
 func (o *Object) SetField(objectPtr interface{}, fieldName string) *PromiseErr {
 	//fmt.Println("[STORED] SetField:", o.name)
 
@@ -604,6 +707,17 @@ func (o *Object) SetField(objectPtr interface{}, fieldName string) *PromiseErr {
 					if err != nil {
 						return p.fail(err)
 					}
+					if !o.plainPacked(allData) {
+						packedFields, err := o.editPacked(allData, func(value reflect.Value) error {
+							value.Field(field.Num).Set(input.value.Field(field.Num))
+							return nil
+						})
+						if err != nil {
+							return p.fail(err)
+						}
+						p.tr.Set(immutableFieldsKey, packedFields)
+						return p.ok()
+					}
 					immutableFields := map[string]interface{}{}
 					err = msgpack.Unmarshal(allData, &immutableFields)
 					if err != nil {
@@ -613,7 +727,11 @@ func (o *Object) SetField(objectPtr interface{}, fieldName string) *PromiseErr {
 					for key, _ := range immutableFields {
 						if key == field.Name {
 							data := input.value.Field(field.Num)
-							immutableFields[key] = data.Interface()
+							packed, err := field.packValue(data)
+							if err != nil {
+								return p.fail(err)
+							}
+							immutableFields[key] = packed
 						}
 					}
 
@@ -656,36 +774,118 @@ func (o *Object) Add(data interface{}) *PromiseErr {
 	input := structEditable(data)
 	p := o.promiseErr()
 	p.do(func() Chain {
-		for _, field := range o.getFields() {
-			if field.AutoIncrement {
-				incKey := o.miscDir.Pack(tuple.Tuple{"ai", field.Name})
-				p.tr.Add(incKey, GetPlus(field.Kind))
-				autoIncrementValue := p.tr.Get(incKey).MustGet()
-				input.setFieldAutoIncr(field, autoIncrementValue)
-			} else if field.GenID != 0 {
-				input.value.Field(field.Num).SetInt(field.GenerateID())
-				//input.setField(field, field.GenerateID()) //if generateID would be bytearray
-			}
+		o.generateIDs(p.tr, input)
+		return o.insert(p.self(), input)
+	})
+	return p
+}
+
+// insert writes the new object with primary already set, fails with ErrAlreadyExist if primary is taken
+func (o *Object) insert(p *Promise, input *Struct) Chain {
+	primaryTuple := input.getPrimary(o)
+	sub := o.primary.Sub(primaryTuple...)
+
+	isSet := p.tr.GetKey(fdb.FirstGreaterThan(sub))
+	return func() Chain {
+		firstKey, err := isSet.Get()
+		if err != nil {
+			return p.fail(err)
+		}
+		if sub.Contains(firstKey) {
+			return p.fail(ErrAlreadyExist)
 		}
 
-		primaryTuple := input.getPrimary(o)
-		sub := o.primary.Sub(primaryTuple...)
+		err = o.doWrite(p.self(), sub, primaryTuple, input, nil, true)
+		if err != nil {
+			return p.fail(err)
+		}
+		return p.ok()
+	}
+}
+
+// generateIDs fills autoincrement and generated id fields of the input
+func (o *Object) generateIDs(tr fdb.Transaction, input *Struct) {
+	for _, field := range o.getFields() {
+		if field.AutoIncrement {
+			incKey := o.miscDir.Pack(tuple.Tuple{"ai", field.Name})
+			tr.Add(incKey, GetPlus(field.Kind))
+			autoIncrementValue := tr.Get(incKey).MustGet()
+			input.setFieldAutoIncr(field, autoIncrementValue)
+		} else if field.GenID != 0 {
+			input.value.Field(field.Num).SetInt(field.GenerateID())
+			//input.setField(field, field.GenerateID()) //if generateID would be bytearray
+		}
+	}
+}
+
+// primaryGenerated checks if primary of the input is empty and should be generated on insert
+func (o *Object) primaryGenerated(input *Struct) bool {
+	for _, field := range o.primaryFields {
+		if (field.AutoIncrement || field.GenID != 0) && field.isEmpty(input.Get(field)) {
+			return true
+		}
+	}
+	return false
+}
 
-		isSet := p.tr.GetKey(fdb.FirstGreaterThan(sub))
+// changeCounters moves the object between counters when counted fields were changed
+func (o *Object) changeCounters(tr fdb.Transaction, oldObject, input *Struct) {
+	for _, ctr := range o.counters {
+		if reflect.DeepEqual(oldObject.getTuple(ctr.fields), input.getTuple(ctr.fields)) {
+			continue
+		}
+		ctr.decrement(tr, oldObject)
+		ctr.increment(tr, input)
+	}
+}
+
+// Upsert inserts the object if it is absent, otherwise merge is called with pointers to the stored
+// and the passed objects and the stored object changed by merge is written. If merge is nil the passed
+// object overwrites the stored one. Autoincrement and generated ids are set only when the primary is
+// empty. After the call objectPtr contains written data, Bool reports whether the object was inserted
+func (o *Object) Upsert(objectPtr interface{}, merge func(stored, input interface{}) error) *Promise {
+	input := structEditable(objectPtr)
+	p := o.promise()
+	p.do(func() Chain {
+		if o.primaryGenerated(input) {
+			o.generateIDs(p.tr, input)
+		}
+		primaryTuple := input.getPrimary(o)
+		sub := o.sub(primaryTuple)
+		needed := o.need(p.tr, sub)
 		return func() Chain {
-			firstKey, err := isSet.Get()
+			value, err := needed.fetch()
+			if err == ErrNotFound {
+				err = o.doWrite(p.self(), sub, primaryTuple, input, nil, true)
+				if err != nil {
+					return p.fail(err)
+				}
+				return p.done(true)
+			}
 			if err != nil {
 				return p.fail(err)
 			}
-			if sub.Contains(firstKey) {
-				return p.fail(ErrAlreadyExist)
+			stored, err := value.Reflect()
+			if err != nil {
+				return p.fail(err)
 			}
-
-			err = o.doWrite(p.tr, sub, primaryTuple, input, nil, true)
+			oldObject := structAny(value.Interface())
+			if merge != nil {
+				err = merge(stored.Addr().Interface(), objectPtr)
+				if err != nil {
+					return p.fail(err)
+				}
+				input.value.Set(stored)
+				if !reflect.DeepEqual(input.getPrimary(o), primaryTuple) {
+					return p.fail(ErrPrimaryChanged)
+				}
+			}
+			err = o.doWrite(p.self(), sub, primaryTuple, input, oldObject, false)
 			if err != nil {
 				return p.fail(err)
 			}
-			return p.ok()
+			o.changeCounters(p.tr, oldObject, input)
+			return p.done(false)
 		}
 	})
 	return p
@@ -714,6 +914,10 @@ func (o *Object) Delete(objOrID interface{}) *PromiseErr {
 				return p.fail(err)
 			}
 			object := structAny(value.Interface())
+			err = o.runHooks(p.self(), o.hooks.beforeDelete, object, nil)
+			if err != nil {
+				return p.fail(err)
+			}
 
 			// remove object key
 			//start, end := sub.FDBRangeKeys()
@@ -724,7 +928,10 @@ func (o *Object) Delete(objOrID interface{}) *PromiseErr {
 
 			// remove indexes
 			for _, index := range o.indexes {
-				toDelete := index.getKey(object)
+				toDelete := index.writeKey(object)
+				if toDelete == nil { // object was not indexed
+					continue
+				}
 				index.Delete(p.tr, primaryTuple, toDelete)
 			}
 
@@ -732,6 +939,10 @@ func (o *Object) Delete(objOrID interface{}) *PromiseErr {
 				ctr.decrement(p.tr, object)
 			}
 
+			err = o.runHooks(p.self(), o.hooks.afterDelete, object, nil)
+			if err != nil {
+				return p.fail(err)
+			}
 			return p.ok()
 		}
 	})
@@ -773,7 +984,10 @@ func (o *Object) GetBy(objectPtr interface{}, indexKeys ...string) *PromiseErr {
 				object: o,
 			}
 			value.FromKeyValue(sub, rows)
-			input.Fill(o, &value)
+			err = input.Fill(o, &value)
+			if err != nil {
+				return p.fail(err)
+			}
 			return p.done(nil)
 		}
 	})
@@ -798,7 +1012,10 @@ func (o *Object) MultiGet(sliceObjectPtr interface{}) *PromiseErr {
 				continue
 				//return p.fail(err)
 			}
-			input.Fill(o, value)
+			err = input.Fill(o, value)
+			if err != nil {
+				return p.fail(err)
+			}
 		}
 		return p.done(nil)
 	})
@@ -835,8 +1052,10 @@ func (o *Object) Get(objectPtr interface{}) *PromiseErr {
 				return p.fail(err)
 			}
 
-			input.Fill(o, res)
-
+			err = input.Fill(o, res)
+			if err != nil {
+				return p.fail(err)
+			}
 			return p.done(nil)
 		}
 	})
@@ -1005,6 +1224,54 @@ func (o *Object) need(tr fdb.ReadTransaction, sub subspace.Subspace) *needObject
 	return &needed
 }
 
+// needFields requests only selected fields of the object
+func (o *Object) needFields(tr fdb.ReadTransaction, sub subspace.Subspace, fields []*Field) *needObject {
+	needed := needObject{
+		object:   o,
+		subspace: sub,
+	}
+	needed.needFields(tr, sub, fields)
+	return &needed
+}
+
+// selection returns set of field names to fill, primary fields are always filled
+func (o *Object) selection(fields []*Field) map[string]bool {
+	selected := map[string]bool{}
+	for _, field := range o.primaryFields {
+		selected[field.Name] = true
+	}
+	for _, field := range fields {
+		selected[field.Name] = true
+	}
+	return selected
+}
+
+// GetFields fetches only the passed fields of the object, other fields will be left empty.
+// Only keys of selected fields are read and only selected entries of packed immutable fields are decoded
+func (o *Object) GetFields(objectPtr interface{}, fieldNames ...string) *PromiseErr {
+	fields := make([]*Field, len(fieldNames))
+	for k, fieldName := range fieldNames {
+		fields[k] = o.field(fieldName)
+	}
+	input := structEditable(objectPtr)
+	p := o.promiseErr()
+	p.doRead(func() Chain {
+		needed := o.needFields(p.readTr, input.getSubspace(o), fields)
+		return func() Chain {
+			res, err := needed.fetch()
+			if err != nil {
+				return p.fail(err)
+			}
+			err = input.Fill(o, res)
+			if err != nil {
+				return p.fail(err)
+			}
+			return p.done(nil)
+		}
+	})
+	return p
+}
+
 // List queries list of items using primary key subspace. Pass no params if fetching all objects
 func (o *Object) List(primary ...interface{}) *Query {
 	query := Query{object: o}
@@ -1017,12 +1284,29 @@ func (o *Object) ListAll() *Query {
 	return &query
 }
 
+// Where queries objects matching the condition, chain Where of the query to add more conditions
+func (o *Object) Where(fieldName string, op Operator, value interface{}) *Query {
+	query := Query{object: o}
+	return query.Where(fieldName, op, value)
+}
+
 // Use is an index selector for query building
 func (o *Object) Use(indexFieldNames ...string) *Query {
 	query := Query{object: o}
 	return query.Use(indexFieldNames...)
 }
 
+// VerifyIndex checks consistency of the index declared for the fields, see Index.Verify.
+// Returns primaries of inconsistent objects
+func (o *Object) VerifyIndex(indexFieldNames ...string) ([]tuple.Tuple, error) {
+	name := strings.Join(indexFieldNames, ",")
+	index, ok := o.indexes[name]
+	if !ok {
+		o.panic("index «" + name + "» not found")
+	}
+	return index.Verify()
+}
+
 // Reindex will go around all data and delete add every row
 func (o *Object) Reindex() {
 	//fmt.Println("[STORED] Reindex:", o.name)
@@ -45,6 +45,8 @@ func (ob *ObjectBuilder) buildScheme(schemeObj interface{}) {
 		}
 
 		field.Kind = field.Value.Kind()
+		field.codec = codecOf(field.Type.Type)
+		field.initElem()
 		if field.Kind == reflect.Slice {
 			field.SubKind = field.Value.Type().Elem().Kind()
 		}
@@ -55,6 +57,10 @@ func (ob *ObjectBuilder) buildScheme(schemeObj interface{}) {
 			if tag.AutoIncrement {
 				field.SetAutoIncrement()
 			}
+			field.setRules(tag.rules)
+			if field.rules != nil {
+				o.ruledFields = append(o.ruledFields, &field)
+			}
 			if tag.Primary {
 				primaryFields = append(primaryFields, tag.Name)
 				//o.setPrimary(tag.Name)
@@ -80,6 +86,12 @@ func (ob *ObjectBuilder) buildScheme(schemeObj interface{}) {
 					o.immutableFields[tag.Name] = &field
 				}
 			}
+			if tag.atomic {
+				if !field.mutable || !(isIntKind(field.Kind) || isUintKind(field.Kind)) {
+					field.panic("atomic option requires mutable integer field")
+				}
+				field.native = true
+			}
 			// init unique field here, tmp disabled, need to test
 			//if tag.unique {
 			//	ob.Unique(field.Name)
@@ -182,6 +194,12 @@ func (ob *ObjectBuilder) need() {
 func (ob *ObjectBuilder) Done() *Object {
 	ob.waitAll.Wait()
 	ob.scheme.buildCurrent(ob)
+	err := ob.scheme.save(ob)
+	if err != nil {
+		ob.panic("could not save scheme: " + err.Error())
+	}
+	ob.object.schemeVersion = ob.scheme.latest
+	ob.object.codecs = ob.scheme.codecs()
 	return ob.object
 }
 
@@ -238,6 +256,27 @@ func (ob *ObjectBuilder) Primary(names ...string) *ObjectBuilder {
 	return ob
 }
 
+// Codec sets the way packed immutable fields are encoded. Codec is stored inside the scheme,
+// so rows written before the change are still readable
+func (ob *ObjectBuilder) Codec(codec Codec) *ObjectBuilder {
+	RegisterCodec(codec)
+	ob.mux.Lock()
+	ob.object.codec = codec
+	ob.mux.Unlock()
+
+	return ob
+}
+
+// Validate adds validator for cross-field rules, it is called with pointer to the object before the write,
+// the same way hooks are. Returned *ValidationError is merged with errors of field rules
+func (ob *ObjectBuilder) Validate(validator func(obj interface{}) error) *ObjectBuilder {
+	ob.mux.Lock()
+	ob.object.validators = append(ob.object.validators, validator)
+	ob.mux.Unlock()
+
+	return ob
+}
+
 // IDDate is unique id generated using date as first part, this approach is usefull
 // if date index necessary too
 // field type should be int64
@@ -272,33 +311,47 @@ func (ob *ObjectBuilder) AutoIncrement(name string) *ObjectBuilder {
 	return ob
 }
 
+// IndexBuilder is returned by index declarations, it allows to make the index partial using Where and
+// continues the object declaration since it embeds *ObjectBuilder
+type IndexBuilder struct {
+	*ObjectBuilder
+	index *Index
+}
+
+// Where makes the index partial: only objects matching all the conditions will be indexed.
+// Conditions are stored inside the scheme
+func (ib *IndexBuilder) Where(fieldName string, op Operator, value interface{}) *IndexBuilder {
+	ib.index.Where(fieldName, op, value)
+	return ib
+}
+
 // Unique index: if object with same field value already presented, Set and Add will return an ErrAlreadyExist
-func (ob *ObjectBuilder) Unique(names ...string) *ObjectBuilder {
+func (ob *ObjectBuilder) Unique(names ...string) *IndexBuilder {
 	index := ob.addFieldIndex(names)
 	index.Unique = true
-	return ob
+	return &IndexBuilder{ObjectBuilder: ob, index: index}
 }
 
 // UniqueOptional index: if object with same field value already presented, Set and Add will return an ErrAlreadyExist
 // If the value is empty index do not set
-func (ob *ObjectBuilder) UniqueOptional(names ...string) *ObjectBuilder {
+func (ob *ObjectBuilder) UniqueOptional(names ...string) *IndexBuilder {
 	index := ob.addFieldIndex(names)
 	index.Unique = true
 	index.optional = true
-	return ob
+	return &IndexBuilder{ObjectBuilder: ob, index: index}
 }
 
 // Index add an simple index for specific key or set of keys
-func (ob *ObjectBuilder) Index(names ...string) *ObjectBuilder {
-	ob.addFieldIndex(names)
-	return ob
+func (ob *ObjectBuilder) Index(names ...string) *IndexBuilder {
+	index := ob.addFieldIndex(names)
+	return &IndexBuilder{ObjectBuilder: ob, index: index}
 }
 
 // IndexOptional is the simple index which will be written only if field is not empty
-func (ob *ObjectBuilder) IndexOptional(names ...string) *ObjectBuilder {
+func (ob *ObjectBuilder) IndexOptional(names ...string) *IndexBuilder {
 	index := ob.addFieldIndex(names)
 	index.optional = true
-	return ob
+	return &IndexBuilder{ObjectBuilder: ob, index: index}
 }
 
 // FastIndex will set index storing copy of object, performing denormalisation
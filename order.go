@@ -0,0 +1,234 @@
+package stored
+
+import (
+	"container/heap"
+	"errors"
+	"reflect"
+	"sort"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// DefaultSortMemory is the max size of objects kept in memory while sorting query results by
+// field not covered by any index, use Query.SortMemory to change it for the query
+var DefaultSortMemory = 64 << 20
+
+// ErrSortMemory returned when objects to sort do not fit into the memory limit
+var ErrSortMemory = errors.New("Sort exceeds memory limit")
+
+// sortRow is the object kept in memory while sorting
+type sortRow struct {
+	value *Value
+	key   interface{}
+	num   int // position in the scan, keeps sort stable
+	size  int
+}
+
+// sortHeap keeps the row which should be returned last on top
+type sortHeap struct {
+	rows []sortRow
+	desc bool
+}
+
+func (h *sortHeap) before(a, b *sortRow) bool {
+	cmp, _ := compareValues(a.key, b.key)
+	if h.desc {
+		cmp = -cmp
+	}
+	if cmp != 0 {
+		return cmp < 0
+	}
+	return a.num < b.num
+}
+
+func (h *sortHeap) Len() int           { return len(h.rows) }
+func (h *sortHeap) Less(i, j int) bool { return h.before(&h.rows[j], &h.rows[i]) }
+func (h *sortHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *sortHeap) Push(x interface{}) { h.rows = append(h.rows, x.(sortRow)) }
+func (h *sortHeap) Pop() interface{} {
+	row := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return row
+}
+
+// OrderBy sorts the objects by the field. Index with the field is used if the query could be resolved
+// with it, otherwise objects are sorted in memory: with Limit only top objects are kept, without Limit
+// all objects should fit into SortMemory. Unless the query is bound to a transaction, objects are
+// scanned in chunks of separate read transactions, so the result is not a consistent snapshot.
+// Pagination is not supported for objects sorted in memory.
+// Reverse inverts the direction. Nullable fields and fields with custom codecs could not be sorted
+func (q *Query) OrderBy(fieldName string, desc bool) *Query {
+	field := q.object.field(fieldName)
+	if !field.sortable() {
+		q.object.panic("field «" + fieldName + "» could not be used in OrderBy, values of its type are not comparable")
+	}
+	q.order = field
+	q.desc = desc
+	q.reverse = q.reversed != q.desc
+	return q
+}
+
+// sortable checks if compareValues could order values of the field
+func (f *Field) sortable() bool {
+	if f.nullable() || f.codec.custom() {
+		return false
+	}
+	if f.codec == codecTime || f.Type.Type == typeOfBytes {
+		return true
+	}
+	return isNumberKind(f.Kind) || f.Kind == reflect.String || f.Kind == reflect.Bool
+}
+
+// SortMemory sets the max size in bytes of objects kept in memory while sorting
+func (q *Query) SortMemory(bytes int) *Query {
+	q.sortMemory = bytes
+	return q
+}
+
+// orderedByIndex checks if scan returns objects in the order of OrderBy field
+func (q *Query) orderedByIndex() bool {
+	if q.index != nil {
+		return len(q.index.fields) > len(q.primary) && q.index.fields[len(q.primary)] == q.order &&
+			q.index.handle == nil && !q.index.search && q.index.Geo == 0
+	}
+	return q.orderPlan() != nil
+}
+
+// orderPlan returns plan scanning primary or index in the order of OrderBy field, nil if there
+// is no such index
+func (q *Query) orderPlan() *queryPlan {
+	primaryFields := q.object.primaryFields
+	if len(primaryFields) > len(q.primary) && primaryFields[len(q.primary)] == q.order {
+		return &queryPlan{residual: q.conditions, filters: q.filters}
+	}
+	if q.primary != nil || q.from != nil || q.to != nil {
+		return nil
+	}
+	var best *indexScan
+	for _, index := range q.object.indexes {
+		scan := q.planOrderIndex(index)
+		if scan == nil {
+			continue
+		}
+		if best == nil || scan.equal > best.equal || (scan.equal == best.equal && scan.index.Name < best.index.Name) {
+			best = scan
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	plan := queryPlan{scans: []*indexScan{best}, filters: q.filters}
+	for k := range q.conditions {
+		resolved := false
+		for n := range best.conditions {
+			if q.conditions[k].equal(&best.conditions[n]) {
+				resolved = true
+			}
+		}
+		if !resolved {
+			plan.residual = append(plan.residual, q.conditions[k])
+		}
+	}
+	return &plan
+}
+
+// planOrderIndex builds index scan sorted by OrderBy field, fields of the index before it should
+// be fixed by equality conditions
+func (q *Query) planOrderIndex(index *Index) *indexScan {
+	if index.search || index.Geo != 0 || index.handle != nil || index.checkHandler != nil || index.optional {
+		return nil
+	}
+	for k := range index.conditions {
+		implied := false
+		for n := range q.conditions {
+			if q.conditions[n].equal(&index.conditions[k]) {
+				implied = true
+			}
+		}
+		if !implied {
+			return nil
+		}
+	}
+	scan := indexScan{index: index}
+	prefix := tuple.Tuple{}
+	for _, field := range index.fields {
+		if field == q.order {
+			lower := q.findCondition(field, Gt, Gte)
+			upper := q.findCondition(field, Lt, Lte)
+			if lower != nil {
+				scan.conditions = append(scan.conditions, *lower)
+			}
+			if upper != nil {
+				scan.conditions = append(scan.conditions, *upper)
+			}
+			scan.ranges = []fdb.KeyRange{scan.getRange(prefix, lower, upper)}
+			return &scan
+		}
+		cond := q.findCondition(field, Eq)
+		if cond == nil {
+			return nil
+		}
+		prefix = append(prefix, field.tupleElement(cond.value))
+		scan.equal++
+		scan.conditions = append(scan.conditions, *cond)
+	}
+	return nil
+}
+
+// valueSize estimates memory used by the object
+func valueSize(value *Value) int {
+	size := 64
+	for key, raw := range value.raw {
+		size += len(key) + len(raw)
+	}
+	return size
+}
+
+// executeSorted scans all objects of the query and sorts them in memory
+func (q *Query) executeSorted(p *PromiseSlice) Chain {
+	memory := q.sortMemory
+	if memory == 0 {
+		memory = DefaultSortMemory
+	}
+	h := sortHeap{desc: q.reverse}
+	size := 0
+	num := 0
+	scan := *q
+	scan.reverse = false
+	scan.limit = 0
+	scan.resume = nil
+	err := scan.scanChunks(&p.Promise, scan.getPlan(), 0, func(value *Value, resume fdb.Key) error {
+		row := sortRow{
+			value: value,
+			key:   structAny(value.Interface()).Get(q.order),
+			num:   num,
+			size:  valueSize(value),
+		}
+		num++
+		if q.limit != 0 && h.Len() >= q.limit {
+			if !h.before(&row, &h.rows[0]) {
+				return nil
+			}
+			size -= heap.Pop(&h).(sortRow).size
+		}
+		heap.Push(&h, row)
+		size += row.size
+		if size > memory {
+			return ErrSortMemory
+		}
+		return nil
+	})
+	if err != nil {
+		return p.fail(err)
+	}
+	sort.Slice(h.rows, func(i, j int) bool {
+		return h.before(&h.rows[i], &h.rows[j])
+	})
+	slice := Slice{}
+	for k := range h.rows {
+		slice.Append(h.rows[k].value)
+	}
+	q.next.resume = nil
+	return p.done(&slice)
+}
@@ -0,0 +1,170 @@
+package stored
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
+// ScanOption is the option struct of ParallelScan
+type ScanOption struct {
+	// Batch is the number of objects fetched within one transaction, 100 by default
+	Batch int
+	// Progress is called after each batch of the shard was processed, could be called from several goroutines
+	Progress func(progress ScanProgress)
+}
+
+// ScanProgress describes the state of one shard of ParallelScan
+type ScanProgress struct {
+	Shard   int
+	Begin   fdb.Key
+	End     fdb.Key
+	Scanned int   // number of objects passed to the callback
+	Done    bool  // shard is fully scanned
+	Err     error // error which stopped the shard
+}
+
+// ParallelScan passes all objects to the callback using several workers. Primary range is split into
+// shards using FoundationDB boundary keys, every shard is scanned by batches within separate
+// transactions. Callback is called outside of transactions from several goroutines. If the callback
+// returns an error the shard is stopped, other shards will continue. Returns progress of all shards
+// and the first error happened
+func (o *Object) ParallelScan(workers int, fn func(obj interface{}) error, options ...ScanOption) ([]ScanProgress, error) {
+	option := ScanOption{Batch: 100}
+	for _, opt := range options {
+		if opt.Batch > 0 {
+			option.Batch = opt.Batch
+		}
+		if opt.Progress != nil {
+			option.Progress = opt.Progress
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	shards, err := o.shards()
+	if err != nil {
+		return nil, err
+	}
+	progress := make([]ScanProgress, len(shards))
+	for k, shard := range shards {
+		progress[k] = ScanProgress{Shard: k, Begin: shard.Begin.FDBKey(), End: shard.End.FDBKey()}
+	}
+
+	queue := make(chan int, len(shards))
+	for k := range shards {
+		queue <- k
+	}
+	close(queue)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range queue {
+				o.scanShard(&progress[k], option, fn)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, shard := range progress {
+		if shard.Err != nil {
+			return progress, shard.Err
+		}
+	}
+	return progress, nil
+}
+
+// shards splits primary range by boundary keys aligned to the beginning of objects
+func (o *Object) shards() ([]fdb.KeyRange, error) {
+	begin, end := o.primary.FDBRangeKeys()
+	boundaries, err := o.db.LocalityGetBoundaryKeys(fdb.KeyRange{Begin: begin, End: end}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	keyLen := len(o.primaryFields)
+	keys := []fdb.Key{begin.FDBKey()}
+	for _, boundary := range boundaries {
+		fullTuple, err := o.primary.Unpack(boundary)
+		if err != nil || len(fullTuple) < keyLen {
+			continue // boundary inside the key of an object
+		}
+		key := o.primary.Pack(fullTuple[:keyLen])
+		if bytes.Compare(key, keys[0]) > 0 && bytes.Compare(key, end.FDBKey()) < 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	shards := []fdb.KeyRange{}
+	for k, key := range keys {
+		if k > 0 && bytes.Equal(key, keys[k-1]) {
+			continue
+		}
+		if len(shards) > 0 {
+			shards[len(shards)-1].End = key
+		}
+		shards = append(shards, fdb.KeyRange{Begin: key, End: end})
+	}
+	return shards, nil
+}
+
+// scanShard scans one shard by batches, each batch within its own transaction
+func (o *Object) scanShard(progress *ScanProgress, option ScanOption, fn func(obj interface{}) error) {
+	report := func() {
+		if option.Progress != nil {
+			option.Progress(*progress)
+		}
+	}
+	r := fdb.KeyRange{Begin: progress.Begin, End: progress.End}
+	for {
+		resp, err := o.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
+			scanner := o.scanPrimary(tr.Snapshot(), r, false)
+			values := []*Value{}
+			var resume fdb.Key
+			for value := scanner.next(); value != nil; value = scanner.next() {
+				values = append(values, value)
+				if len(values) >= option.Batch {
+					resume = o.resumeKey(scanner.current, false)
+					break
+				}
+			}
+			if scanner.err != nil {
+				return nil, scanner.err
+			}
+			return &shardBatch{values: values, resume: resume}, nil
+		})
+		if err != nil {
+			progress.Err = err
+			report()
+			return
+		}
+		batch := resp.(*shardBatch)
+		for _, value := range batch.values {
+			err = fn(value.Interface())
+			if err != nil {
+				progress.Err = err
+				report()
+				return
+			}
+			progress.Scanned++
+		}
+		if batch.resume == nil {
+			progress.Done = true
+			report()
+			return
+		}
+		report()
+		r.Begin = batch.resume
+	}
+}
+
+// shardBatch is the result of one transaction of the shard scan
+type shardBatch struct {
+	values []*Value
+	resume fdb.Key
+}
@@ -0,0 +1,541 @@
+package stored
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/subspace"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+type patchOpKind int
+
+const (
+	patchSet patchOpKind = iota
+	patchInc
+	patchAppend
+	patchMax
+	patchMin
+	patchBitOr
+	patchBitAnd
+	patchBitXor
+)
+
+type patchOp struct {
+	kind  patchOpKind
+	field *Field
+	value reflect.Value
+}
+
+// Patch changes only selected fields of the object without rewriting the whole object.
+// Only keys of changed fields are read and written and only dependent indexes and counters are updated.
+// Objects with write hooks, defaults or validation are read and rewritten whole, so they are applied
+type Patch struct {
+	object     *Object
+	primary    tuple.Tuple
+	ops        []patchOp
+	conditions []condition
+}
+
+// Patch returns patch of the object by id or object with primary set. Changes could be passed as map
+// of field names to new values, or added using Set, Inc and Append methods
+func (o *Object) Patch(objOrID interface{}, changes ...map[string]interface{}) *Patch {
+	pt := &Patch{
+		object:  o,
+		primary: o.getPrimaryTuple(objOrID),
+	}
+	for _, fields := range changes {
+		for fieldName, value := range fields {
+			pt.Set(fieldName, value)
+		}
+	}
+	return pt
+}
+
+// CompareAndSet sets the field to the value only if it is equal to expected one inside the transaction,
+// PreconditionError returned otherwise
+func (o *Object) CompareAndSet(objOrID interface{}, fieldName string, expected, value interface{}) *PromiseErr {
+	return o.Patch(objOrID).If(fieldName, Eq, expected).Set(fieldName, value).Promise()
+}
+
+// SetIf applies changes only if stored fields are equal to the conditions values inside the transaction,
+// PreconditionError returned otherwise. Use Patch with If for other operators
+func (o *Object) SetIf(objOrID interface{}, conditions, changes map[string]interface{}) *PromiseErr {
+	pt := o.Patch(objOrID, changes)
+	for fieldName, expected := range conditions {
+		pt.If(fieldName, Eq, expected)
+	}
+	return pt.Promise()
+}
+
+func (pt *Patch) field(fieldName string) *Field {
+	field := pt.object.field(fieldName)
+	if field.primary {
+		pt.object.panic("primary field «" + fieldName + "» could not be patched")
+	}
+	if field.UnStored {
+		pt.object.panic("unstored field «" + fieldName + "» could not be patched")
+	}
+	return field
+}
+
+// convert returns value converted to the type, panics if it is not possible
+func (pt *Patch) convert(field *Field, value interface{}, t reflect.Type) reflect.Value {
+	if value == nil {
+		return reflect.Zero(t)
+	}
+	v := reflect.ValueOf(value)
+	if !v.Type().ConvertibleTo(t) {
+		pt.object.panic("value of type " + v.Type().String() + " could not be set to field «" + field.Name + "»")
+	}
+	return v.Convert(t)
+}
+
+// If adds precondition, patch fails with PreconditionError if the stored object does not match it
+func (pt *Patch) If(fieldName string, op Operator, value interface{}) *Patch {
+	pt.conditions = append(pt.conditions, newCondition(pt.object, fieldName, op, value))
+	return pt
+}
+
+// Set sets the field to the value
+func (pt *Patch) Set(fieldName string, value interface{}) *Patch {
+	field := pt.field(fieldName)
+	pt.ops = append(pt.ops, patchOp{
+		kind:  patchSet,
+		field: field,
+		value: pt.convert(field, value, field.Type.Type),
+	})
+	return pt
+}
+
+// Inc adds the number to the numeric field, floats are supported
+func (pt *Patch) Inc(fieldName string, value interface{}) *Patch {
+	return pt.numeric(patchInc, fieldName, value)
+}
+
+// numeric adds operation over numeric field
+func (pt *Patch) numeric(kind patchOpKind, fieldName string, value interface{}) *Patch {
+	field := pt.field(fieldName)
+	if !isNumberKind(field.Kind) {
+		pt.object.panic("field «" + fieldName + "» is not numeric")
+	}
+	if kind >= patchBitOr && !isIntKind(field.Kind) && !isUintKind(field.Kind) {
+		pt.object.panic("bitwise operation on float field «" + fieldName + "»")
+	}
+	pt.ops = append(pt.ops, patchOp{
+		kind:  kind,
+		field: field,
+		value: pt.convert(field, value, field.Type.Type),
+	})
+	return pt
+}
+
+// Append appends values to the slice field
+func (pt *Patch) Append(fieldName string, values ...interface{}) *Patch {
+	field := pt.field(fieldName)
+	if field.Kind != reflect.Slice {
+		pt.object.panic("field «" + fieldName + "» is not a slice")
+	}
+	for _, value := range values {
+		pt.ops = append(pt.ops, patchOp{
+			kind:  patchAppend,
+			field: field,
+			value: pt.convert(field, value, field.Type.Type.Elem()),
+		})
+	}
+	return pt
+}
+
+// dependencies returns fields which should be read, indexes which should be updated, and full
+// when the whole object is needed because some index is calculated by a handler
+func (pt *Patch) dependencies(ops []patchOp) (fields []*Field, indexes []*Index, full bool) {
+	o := pt.object
+	changed := map[string]bool{}
+	selected := map[string]bool{}
+	need := func(field *Field) {
+		if !selected[field.Name] {
+			selected[field.Name] = true
+			fields = append(fields, field)
+		}
+	}
+	immutableChanged := false
+	for _, op := range ops {
+		changed[op.field.Name] = true
+		need(op.field)
+		if !op.field.mutable {
+			immutableChanged = true
+		}
+	}
+	for _, cond := range pt.conditions {
+		need(cond.field)
+	}
+	if immutableChanged { // packed fields are rewritten together
+		for _, field := range o.immutableFields {
+			need(field)
+		}
+	}
+	for _, index := range o.indexes {
+		if index.handle != nil || index.checkHandler != nil {
+			indexes = append(indexes, index)
+			full = true
+			continue
+		}
+		depends := index.dependsOn()
+		if !fieldsChanged(depends, changed) {
+			continue
+		}
+		indexes = append(indexes, index)
+		for _, field := range depends {
+			need(field)
+		}
+	}
+	for _, ctr := range o.counters {
+		if fieldsChanged(ctr.fields, changed) {
+			for _, field := range ctr.fields {
+				need(field)
+			}
+		}
+	}
+	return
+}
+
+// dependent checks if some index or counter depends on the field
+func (pt *Patch) dependent(field *Field) bool {
+	changed := map[string]bool{field.Name: true}
+	for _, index := range pt.object.indexes {
+		if index.handle != nil || index.checkHandler != nil || fieldsChanged(index.dependsOn(), changed) {
+			return true
+		}
+	}
+	for _, ctr := range pt.object.counters {
+		if fieldsChanged(ctr.fields, changed) {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldsChanged(fields []*Field, changed map[string]bool) bool {
+	for _, field := range fields {
+		if changed[field.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// native checks if the operation could be performed by FDB atomic mutation
+func (op *patchOp) native() bool {
+	switch op.kind {
+	case patchInc, patchBitOr, patchBitAnd, patchBitXor:
+		return true
+	case patchMax, patchMin: // FDB compares values as unsigned integers
+		return isUintKind(op.field.Kind)
+	}
+	return false
+}
+
+// mutate performs the operation using FDB atomic mutation
+func (op *patchOp) mutate(tr fdb.Transaction, key fdb.Key) {
+	param := op.field.nativeBytes(op.value)
+	switch op.kind {
+	case patchInc:
+		tr.Add(key, param)
+	case patchMax:
+		tr.Max(key, param)
+	case patchMin:
+		tr.Min(key, param)
+	case patchBitOr:
+		tr.BitOr(key, param)
+	case patchBitAnd:
+		tr.BitAnd(key, param)
+	case patchBitXor:
+		tr.BitXor(key, param)
+	}
+}
+
+// apply performs the operation on the object value
+func (op *patchOp) apply(value reflect.Value) {
+	objField := value.Field(op.field.Num)
+	switch op.kind {
+	case patchSet:
+		objField.Set(op.value)
+	case patchInc:
+		addNumber(objField, op.value)
+	case patchAppend:
+		objField.Set(reflect.Append(objField, op.value))
+	case patchMax, patchMin:
+		cmp, _ := compareValues(op.value.Interface(), objField.Interface())
+		if op.kind == patchMax && cmp > 0 || op.kind == patchMin && cmp < 0 {
+			objField.Set(op.value)
+		}
+	default:
+		bitwise(op.kind, objField, op.value)
+	}
+}
+
+// addNumber adds delta to the numeric value, delta should be the same kind
+func addNumber(value, delta reflect.Value) {
+	switch {
+	case isIntKind(value.Kind()):
+		value.SetInt(value.Int() + delta.Int())
+	case isUintKind(value.Kind()):
+		value.SetUint(value.Uint() + delta.Uint())
+	default:
+		value.SetFloat(value.Float() + delta.Float())
+	}
+}
+
+// bitwise performs bitwise operation over integer value
+func bitwise(kind patchOpKind, value, param reflect.Value) {
+	var a, b uint64
+	if isIntKind(value.Kind()) {
+		a, b = uint64(value.Int()), uint64(param.Int())
+	} else {
+		a, b = value.Uint(), param.Uint()
+	}
+	switch kind {
+	case patchBitOr:
+		a |= b
+	case patchBitAnd:
+		a &= b
+	case patchBitXor:
+		a ^= b
+	}
+	if isIntKind(value.Kind()) {
+		value.SetInt(int64(a))
+	} else {
+		value.SetUint(a)
+	}
+}
+
+// split returns operations which could be performed by FDB atomic mutations and the rest.
+// Field is mutated atomically only if all of its operations are native and nothing depends on it
+func (pt *Patch) split() (mutations, rest []patchOp) {
+	if len(pt.conditions) > 0 { // conditions should be checked against read value
+		return nil, pt.ops
+	}
+	native := map[string]bool{}
+	for _, op := range pt.ops {
+		ok, seen := native[op.field.Name]
+		if !seen {
+			ok = op.field.atomic() && !pt.dependent(op.field)
+		}
+		native[op.field.Name] = ok && op.native()
+	}
+	for _, op := range pt.ops {
+		if native[op.field.Name] {
+			mutations = append(mutations, op)
+		} else {
+			rest = append(rest, op)
+		}
+	}
+	return
+}
+
+// Promise returns promise which applies the patch, ErrNotFound returned if object does not exist
+func (pt *Patch) Promise() *PromiseErr {
+	return pt.promise(false)
+}
+
+// promise applies the patch, if atomic is set operations which allow it are performed by FDB atomic
+// mutations, the rest using read-modify-write
+func (pt *Patch) promise(atomic bool) *PromiseErr {
+	o := pt.object
+	p := o.promiseErr()
+	p.do(func() Chain {
+		sub := o.sub(pt.primary)
+		mutations, ops := []patchOp(nil), pt.ops
+		if atomic && !o.checkedWrites() {
+			mutations, ops = pt.split()
+		}
+		if len(mutations) == 0 {
+			return pt.write(p, sub, ops)
+		}
+		// mutations are blind, so the object is checked using snapshot read. Read conflict on the
+		// beginning of the object makes the transaction retry if object is rewritten or deleted
+		exists := p.tr.Snapshot().GetKey(fdb.FirstGreaterOrEqual(sub.FDBKey()))
+		p.tr.AddReadConflictKey(sub.FDBKey())
+		current := map[string]fdb.FutureByteSlice{}
+		for _, op := range mutations {
+			if _, ok := current[op.field.Name]; !ok {
+				current[op.field.Name] = p.tr.Snapshot().Get(op.field.getKey(sub))
+			}
+		}
+		return func() Chain {
+			key, err := exists.Get()
+			if err != nil {
+				return p.fail(err)
+			}
+			if !bytes.HasPrefix(key, sub.FDBKey()) {
+				return p.fail(ErrNotFound)
+			}
+			converted := map[string]bool{}
+			for fieldName, future := range current {
+				data, err := future.Get()
+				if err != nil {
+					return p.fail(err)
+				}
+				// value written by msgpack, or missing one, is converted using read-modify-write
+				converted[fieldName] = len(data) != 8
+			}
+			for _, op := range mutations {
+				if converted[op.field.Name] {
+					ops = append(ops, op)
+				} else {
+					op.mutate(p.tr, op.field.getKey(sub))
+				}
+			}
+			if len(ops) == 0 {
+				return p.ok()
+			}
+			return pt.write(p, sub, ops)
+		}
+	})
+	return p
+}
+
+// write applies operations by reading the fields they depend on
+func (pt *Patch) write(p *PromiseErr, sub subspace.Subspace, ops []patchOp) Chain {
+	o := pt.object
+	fields, indexes, full := pt.dependencies(ops)
+	checked := o.checkedWrites()
+	var needed *needObject
+	if full || checked {
+		needed = o.need(p.tr, sub)
+	} else {
+		needed = o.needFields(p.tr, sub, fields)
+	}
+	return func() Chain {
+		value, err := needed.fetch()
+		if err != nil {
+			return p.fail(err)
+		}
+		stored, err := value.Reflect()
+		if err != nil {
+			return p.fail(err)
+		}
+		oldObject := structAny(stored.Interface())
+		for k := range pt.conditions {
+			cond := &pt.conditions[k]
+			if !cond.match(oldObject) {
+				return p.fail(&PreconditionError{
+					Field:    cond.field.Name,
+					Op:       cond.op,
+					Expected: cond.value,
+					Actual:   oldObject.Get(cond.field),
+				})
+			}
+		}
+		input := structEditable(stored.Addr().Interface())
+		if checked {
+			// hooks and validation get the whole object, so it is rewritten as by Set
+			for k := range ops {
+				ops[k].apply(stored)
+			}
+			err = o.doWrite(p.self(), sub, pt.primary, input, oldObject, false)
+			if err != nil {
+				return p.fail(err)
+			}
+			o.changeCounters(p.tr, oldObject, input)
+			return p.ok()
+		}
+
+		immutableChanged := false
+		written := map[string]bool{}
+		for k := range ops {
+			op := &ops[k]
+			op.apply(stored)
+			if op.field.mutable {
+				written[op.field.Name] = true
+			} else {
+				immutableChanged = true
+			}
+		}
+		for fieldName := range written {
+			field := o.mutableFields[fieldName]
+			p.tr.Set(field.getKey(sub), input.GetMutableFieldBytes(field))
+		}
+		if immutableChanged {
+			packedFields, err := o.packFields(input)
+			if err != nil {
+				return p.fail(err)
+			}
+			p.tr.Set(sub.Pack(tuple.Tuple{"*"}), packedFields)
+		}
+
+		for _, index := range indexes {
+			err = index.Write(p.tr, pt.primary, input, oldObject)
+			if err != nil {
+				return p.fail(err)
+			}
+		}
+		o.changeCounters(p.tr, oldObject, input)
+		return p.ok()
+	}
+}
+
+// Err applies the patch and returns an error
+func (pt *Patch) Err() error {
+	return pt.Promise().Err()
+}
+
+// Atomic changes numeric fields of the object. Mutable integer fields which no index or counter depends
+// on are changed by FDB atomic mutations without conflicts, other fields are changed using
+// read-modify-write with indexes and counters maintained. All the fields of objects with write hooks,
+// defaults or validation are changed using read-modify-write
+type Atomic struct {
+	patch *Patch
+}
+
+// Atomic returns atomic operations builder for the object by id or object with primary set
+func (o *Object) Atomic(objOrID interface{}) *Atomic {
+	return &Atomic{patch: o.Patch(objOrID)}
+}
+
+// Add adds the number to the field, floats are supported
+func (a *Atomic) Add(fieldName string, value interface{}) *Atomic {
+	a.patch.numeric(patchInc, fieldName, value)
+	return a
+}
+
+// Max sets the field to the value if it is greater than current one
+func (a *Atomic) Max(fieldName string, value interface{}) *Atomic {
+	a.patch.numeric(patchMax, fieldName, value)
+	return a
+}
+
+// Min sets the field to the value if it is less than current one
+func (a *Atomic) Min(fieldName string, value interface{}) *Atomic {
+	a.patch.numeric(patchMin, fieldName, value)
+	return a
+}
+
+// BitOr performs bitwise or over integer field
+func (a *Atomic) BitOr(fieldName string, value interface{}) *Atomic {
+	a.patch.numeric(patchBitOr, fieldName, value)
+	return a
+}
+
+// BitAnd performs bitwise and over integer field
+func (a *Atomic) BitAnd(fieldName string, value interface{}) *Atomic {
+	a.patch.numeric(patchBitAnd, fieldName, value)
+	return a
+}
+
+// BitXor performs bitwise xor over integer field
+func (a *Atomic) BitXor(fieldName string, value interface{}) *Atomic {
+	a.patch.numeric(patchBitXor, fieldName, value)
+	return a
+}
+
+// Promise returns promise which applies the operations, ErrNotFound returned if object does not exist
+func (a *Atomic) Promise() *PromiseErr {
+	return a.patch.promise(true)
+}
+
+// Err applies the operations and returns an error
+func (a *Atomic) Err() error {
+	return a.Promise().Err()
+}
@@ -16,8 +16,10 @@ type Promise struct {
 	tr        fdb.Transaction
 	chain     Chain
 	after     func() PromiseAny
+	queued    []PromiseAny // enqueued by hooks, performed before after
 	err       error
 	readOnly  bool
+	owned     bool // transaction is created by the promise, so long reads could continue in new ones
 	resp      interface{}
 	confirmed bool
 }
@@ -68,18 +70,38 @@ func (p *Promise) execute() (interface{}, error) {
 	for next != nil {
 		next = next()
 	}
+	if p.err != nil {
+		p.queued = nil // operation failed, promises of hooks are dropped
+	}
+	for _, queued := range p.queued {
+		p.executeNext(queued.self())
+	}
 	if p.after != nil {
-		after := p.after().self()
-		after.tr = p.tr
-		after.readTr = p.readTr
-		after.execute()
+		p.executeNext(p.after().self())
 	}
 	return p.resp, p.err
 }
 
+// executeNext performs promise in the transaction of the current one, its error fails the current promise
+func (p *Promise) executeNext(next *Promise) {
+	next.clear()
+	next.tr = p.tr
+	next.readTr = p.readTr
+	_, err := next.execute()
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+}
+
 func (p *Promise) clear() {
 	p.err = nil
 	p.resp = nil
+	p.queued = nil
+}
+
+// enqueue adds promise performed right after current one in the same transaction
+func (p *Promise) enqueue(promise PromiseAny) {
+	p.queued = append(p.queued, promise)
 }
 
 func (p *Promise) transact() (resp interface{}, err error) {
@@ -90,6 +112,7 @@ func (p *Promise) transact() (resp interface{}, err error) {
 		return
 	}
 	if p.readOnly {
+		p.owned = true
 		resp, err = p.db.ReadTransact(func(tr fdb.ReadTransaction) (interface{}, error) {
 			p.clear() // since transaction could be repeated - should clear everything
 			p.readTr = tr.Snapshot()
@@ -0,0 +1,125 @@
+package stored
+
+import (
+	"errors"
+	"reflect"
+)
+
+// PromiseAggregate is the promise of aggregation result
+type PromiseAggregate struct {
+	Promise
+	task *aggregateTask
+	pick func(a *Aggregate) interface{} // selects value returned by Int64, Float64 and Scan
+}
+
+// Do will attach promise to transaction, so promise will be called within passed transaction
+// Promise should be inside an transaction callback, because transaction could be resent
+func (p *PromiseAggregate) Do(t *Transaction) *PromiseAggregate {
+	if !t.started {
+		panic("transaction not started, could not use in Promise")
+	}
+	p.tr = t.tr
+	p.readTr = t.readTr
+	return p
+}
+
+// Err will execute the promise and return error
+func (p *PromiseAggregate) Err() error {
+	_, err := p.task.run(&p.Promise)
+	return err
+}
+
+// Aggregate returns all aggregated values
+func (p *PromiseAggregate) Aggregate() (*Aggregate, error) {
+	res, err := p.task.run(&p.Promise)
+	if err != nil {
+		return nil, err
+	}
+	return res.total(), nil
+}
+
+// Int64 returns aggregated value as int64
+func (p *PromiseAggregate) Int64() (int64, error) {
+	agg, err := p.Aggregate()
+	if err != nil {
+		return 0, err
+	}
+	value := reflect.ValueOf(p.pick(agg))
+	switch {
+	case isIntKind(value.Kind()):
+		return value.Int(), nil
+	case isUintKind(value.Kind()):
+		return int64(value.Uint()), nil
+	case isNumberKind(value.Kind()):
+		return int64(value.Float()), nil
+	}
+	return 0, errors.New("aggregated value is not number")
+}
+
+// Float64 returns aggregated value as float64
+func (p *PromiseAggregate) Float64() (float64, error) {
+	agg, err := p.Aggregate()
+	if err != nil {
+		return 0, err
+	}
+	value := reflect.ValueOf(p.pick(agg))
+	if !isNumberKind(value.Kind()) {
+		return 0, errors.New("aggregated value is not number")
+	}
+	return toFloat64(value), nil
+}
+
+// Scan sets aggregated value to the passed pointer, returns ErrNotFound if there are no objects
+// to get Min or Max from
+func (p *PromiseAggregate) Scan(valuePointer interface{}) error {
+	agg, err := p.Aggregate()
+	if err != nil {
+		return err
+	}
+	target := reflect.ValueOf(valuePointer)
+	if target.Kind() != reflect.Ptr {
+		panic("Scan requires pointer")
+	}
+	value := reflect.ValueOf(p.pick(agg))
+	if !value.IsValid() {
+		return ErrNotFound
+	}
+	target = target.Elem()
+	if !value.Type().ConvertibleTo(target.Type()) {
+		return errors.New("aggregated value of type " + value.Type().String() + " could not be set to " + target.Type().String())
+	}
+	target.Set(value.Convert(target.Type()))
+	return nil
+}
+
+// PromiseGroups is the promise of grouped aggregation result
+type PromiseGroups struct {
+	Promise
+	task *aggregateTask
+}
+
+// Do will attach promise to transaction, so promise will be called within passed transaction
+// Promise should be inside an transaction callback, because transaction could be resent
+func (p *PromiseGroups) Do(t *Transaction) *PromiseGroups {
+	if !t.started {
+		panic("transaction not started, could not use in Promise")
+	}
+	p.tr = t.tr
+	p.readTr = t.readTr
+	return p
+}
+
+// Err will execute the promise and return error
+func (p *PromiseGroups) Err() error {
+	_, err := p.task.run(&p.Promise)
+	return err
+}
+
+// Groups returns aggregates of each group ordered by group key
+func (p *PromiseGroups) Groups() ([]Aggregate, error) {
+	res, err := p.task.run(&p.Promise)
+	if err != nil {
+		return nil, err
+	}
+	return res.list(), nil
+}
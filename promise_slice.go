@@ -1,11 +1,19 @@
 package stored
 
+import (
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+)
+
 // PromiseSlice is implements everything promise implements but more
 type PromiseSlice struct {
 	Promise
 	limit   int
 	reverse bool
-	onDone  func() // function which will be called once the promise is finished
+	onDone  func()          // function which will be called once the promise is finished
+	after   string          // cursor passed to After
+	cursor  *cursor         // position of the next page, if there are more data
+	fields  map[string]bool // selected fields of returned values
+	stats   *QueryStats     // stats of query execution
 }
 
 // CheckAll will perform promise in parallel with other promises whithin transaction
@@ -78,6 +86,14 @@ func (p *PromiseSlice) Do(t *Transaction) *PromiseSlice {
 
 // done will call original promise done, but also will call onDone handler
 func (p *PromiseSlice) done(resp interface{}) Chain {
+	if slice, ok := resp.(*Slice); ok && p.fields != nil {
+		for _, value := range slice.values {
+			value.fields = p.fields
+		}
+	}
+	if slice, ok := resp.(*Slice); ok && p.stats != nil {
+		p.stats.Returned = slice.Len()
+	}
 	r := p.Promise.done(resp)
 	if p.onDone != nil {
 		p.onDone()
@@ -96,3 +112,44 @@ func (p *PromiseSlice) Reverse(reverse bool) *PromiseSlice {
 	p.reverse = reverse
 	return p
 }
+
+// After continues the list right after the position of the cursor returned by Cursor, supported
+// by IndexSearch.Search, Relation.GetClients and Relation.GetHosts
+func (p *PromiseSlice) After(cursor string) *PromiseSlice {
+	p.after = cursor
+	return p
+}
+
+// Cursor returns opaque token of the position right after the last fetched object, empty string
+// if there are no more objects
+func (p *PromiseSlice) Cursor() string {
+	if !p.confirmed {
+		p.transact()
+	}
+	if p.err != nil || p.cursor == nil {
+		return ""
+	}
+	return p.cursor.encode()
+}
+
+// resumeRange trims the range using cursor passed to After, returns false if range is over
+func (p *PromiseSlice) resumeRange(scope string, r fdb.KeyRange) (fdb.KeyRange, bool, error) {
+	p.cursor = nil
+	if p.after == "" {
+		return r, true, nil
+	}
+	resume, err := resumeCursor(p.after, scope, r, p.reverse)
+	if err != nil {
+		return r, false, err
+	}
+	r, ok := resumeRange(r, resume, p.reverse)
+	return r, ok, nil
+}
+
+// Stats returns stats of query execution, nil if promise is not created by Query
+func (p *PromiseSlice) Stats() *QueryStats {
+	if !p.confirmed {
+		p.transact()
+	}
+	return p.stats
+}
@@ -1,8 +1,11 @@
 package stored
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -20,8 +23,20 @@ type Query struct {
 	to      tuple.Tuple
 	next    struct {
 		from    tuple.Tuple // fills after first slice of data was scanned
+		resume  fdb.Key     // fills after first slice of data was scanned using query plan
+		cursor  fdb.Key     // last scanned key if there are more data to fetch
 		started bool
 	}
+	conditions  []condition
+	filters     []func(obj interface{}) bool
+	resume      fdb.Key  // range bound to continue the query plan from
+	after       string   // cursor passed to After
+	fields      []*Field // selected fields, nil if all fields are necessary
+	order       *Field   // field set by OrderBy
+	desc        bool     // OrderBy direction, combined with reversed into reverse
+	reversed    bool     // set by Reverse and SetReverse
+	sortMemory  int
+	stats       *QueryStats // stats of the last execution
 	limit       int
 	reverse     bool
 	onlyPrimary bool
@@ -41,6 +56,38 @@ func (q *Query) Use(indexFieldNames ...string) *Query {
 	return q
 }
 
+// Where adds condition to the query. If index is not selected with Use the query planner
+// will choose indexes matching the conditions, intersecting results of several indexes;
+// conditions not covered by indexes are checked on fetched objects while scanning
+func (q *Query) Where(fieldName string, op Operator, value interface{}) *Query {
+	q.conditions = append(q.conditions, newCondition(q.object, fieldName, op, value))
+	return q
+}
+
+// Filter adds callback checking each scanned object, only objects the callback returns true
+// for will be returned. Limit counts only matching objects
+func (q *Query) Filter(filter func(obj interface{}) bool) *Query {
+	q.filters = append(q.filters, filter)
+	return q
+}
+
+// Select sets the list of fields to fetch, other fields of the objects will be left empty
+func (q *Query) Select(fieldNames ...string) *Query {
+	q.fields = make([]*Field, len(fieldNames))
+	for k, fieldName := range fieldNames {
+		q.fields[k] = q.object.field(fieldName)
+	}
+	return q
+}
+
+// need requests the object, only selected fields are fetched if query has selection
+func (q *Query) need(tr fdb.ReadTransaction, primaryTuple tuple.Tuple) *needObject {
+	if q.fields != nil {
+		return q.object.needFields(tr, q.object.sub(primaryTuple), q.fields)
+	}
+	return q.object.need(tr, q.object.sub(primaryTuple))
+}
+
 // Limit sets limit for the query
 func (q *Query) Limit(limit int) *Query {
 	q.limit = limit
@@ -49,7 +96,8 @@ func (q *Query) Limit(limit int) *Query {
 
 // Reverse reverse the query order
 func (q *Query) Reverse() *Query {
-	q.reverse = true
+	q.reversed = true
+	q.reverse = q.reversed != q.desc
 	return q
 }
 
@@ -63,7 +111,8 @@ func (q *Query) OnlyPrimary() *Query {
 
 // SetReverse set reverse value from param
 func (q *Query) SetReverse(reverse bool) *Query {
-	q.reverse = reverse
+	q.reversed = reverse
+	q.reverse = q.reversed != q.desc
 	return q
 }
 
@@ -74,12 +123,7 @@ func (q *Query) List(values ...interface{}) *Query {
 	}
 	q.primary = tuple.Tuple{}
 	for _, v := range values {
-		switch t := v.(type) {
-		case byte:
-			q.primary = append(q.primary, []byte{t})
-		default:
-			q.primary = append(q.primary, t)
-		}
+		q.primary = append(q.primary, queryElement(v))
 	}
 
 	if q.index == nil {
@@ -103,12 +147,7 @@ func (q *Query) From(values ...interface{}) *Query {
 	}
 	q.from = tuple.Tuple{}
 	for _, v := range values {
-		switch enc := v.(type) {
-		case byte:
-			q.from = append(q.from, []byte{enc})
-		default:
-			q.from = append(q.from, v)
-		}
+		q.from = append(q.from, queryElement(v))
 	}
 	return q
 }
@@ -121,16 +160,71 @@ func (q *Query) To(values ...interface{}) *Query {
 	}
 	q.to = tuple.Tuple{}
 	for _, v := range values {
-		switch enc := v.(type) {
-		case byte:
-			q.to = append(q.to, []byte{enc})
-		default:
-			q.to = append(q.to, v)
-		}
+		q.to = append(q.to, queryElement(v))
 	}
 	return q
 }
 
+// After continues the query right after the position of the cursor returned by Cursor. The query
+// should be built the same way as the one the cursor was taken from, otherwise ErrCursorInvalid
+// will be returned
+func (q *Query) After(cursor string) *Query {
+	q.after = cursor
+	return q
+}
+
+// Cursor returns opaque token of the position right after the last fetched object, empty string
+// if there are no more objects. Cursor could be passed to the client and resumed in another process
+func (q *Query) Cursor() string {
+	if q.next.cursor == nil {
+		return ""
+	}
+	scope, bounds := q.scanBounds()
+	return newCursor(scope, bounds, q.reverse, q.next.cursor).encode()
+}
+
+// applyAfter checks cursor passed to After and sets the position to continue from
+func (q *Query) applyAfter() error {
+	if q.after == "" {
+		return nil
+	}
+	scope, bounds := q.scanBounds()
+	resume, err := resumeCursor(q.after, scope, bounds, q.reverse)
+	if err != nil {
+		return err
+	}
+	q.resume = resume
+	q.after = ""
+	return nil
+}
+
+// scanBounds returns scope of the scan driving the query and its range
+func (q *Query) scanBounds() (string, fdb.KeyRange) {
+	plan := q.getPlan()
+	if len(plan.scans) == 0 {
+		return "query:" + q.scopeDigest(), q.primaryRange()
+	}
+	ranges := plan.scans[0].ranges
+	return "query:" + plan.scans[0].index.Name + ":" + q.scopeDigest(),
+		fdb.KeyRange{Begin: ranges[0].Begin, End: ranges[len(ranges)-1].End}
+}
+
+// scopeDigest describes conditions, filters and order of the query, so the cursor is not accepted
+// by the query selecting other objects. Filters could not be compared, only their number is taken
+func (q *Query) scopeDigest() string {
+	parts := []string{}
+	for _, cond := range q.conditions {
+		parts = append(parts, fmt.Sprintf("%s %s %#v", cond.field.Name, operatorNames[cond.op], cond.value))
+	}
+	sort.Strings(parts)
+	parts = append(parts, "filters "+strconv.Itoa(len(q.filters)))
+	if q.order != nil {
+		parts = append(parts, "order "+q.order.Name+" "+strconv.FormatBool(q.desc))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
 // Promise will return the primise for the query
 func (q *Query) Promise() *PromiseSlice {
 	return q.execute()
@@ -158,12 +252,68 @@ func (q *Query) Slice() *Slice {
 	//return sliceI.(*Slice)
 }
 
+// primaryRange returns range of primary subspace selected by the query
+func (q *Query) primaryRange() fdb.KeyRange {
+	var sub subspace.Subspace
+	sub = q.object.primary
+	if q.primary != nil {
+
+		sub = sub.Sub(q.primary...)
+	}
+	start, end := sub.FDBRangeKeys()
+	if q.from != nil {
+		if q.reverse {
+			end = sub.Pack(q.from)
+		} else {
+			start = sub.Pack(q.from)
+		}
+	}
+	if q.to != nil {
+		if q.reverse {
+			start = sub.Pack(q.to)
+		} else {
+			end = sub.Pack(q.to)
+		}
+	}
+	return fdb.KeyRange{Begin: start, End: end}
+}
+
+// filtered returns true if objects should be checked while scanning
+func (q *Query) filtered() bool {
+	return len(q.conditions) > 0 || len(q.filters) > 0
+}
+
 // execute the query
 // could be called several times with one query
 func (q *Query) execute() *PromiseSlice {
 	keyLen := len(q.object.primaryFields)
 	p := q.object.promiseSlice()
+	if q.fields != nil {
+		p.fields = q.object.selection(q.fields)
+	}
+	if q.filtered() && q.onlyPrimary {
+		q.object.panic("Where and Filter could not be combined with OnlyPrimary")
+	}
+	err := q.applyAfter()
+	if err != nil {
+		p.doRead(func() Chain {
+			return p.fail(err)
+		})
+		return p
+	}
+	if q.order != nil && q.onlyPrimary && !q.orderedByIndex() {
+		q.object.panic("OrderBy by field without index could not be combined with OnlyPrimary")
+	}
 	p.doRead(func() Chain {
+		q.next.cursor = nil
+		q.stats = &QueryStats{}
+		p.stats = q.stats
+		if q.order != nil && !q.orderedByIndex() {
+			return q.executeSorted(p)
+		}
+		if q.filtered() || (q.order != nil && q.index == nil) {
+			return q.executePlan(p, q.getPlan())
+		}
 		if q.index != nil { // select using index
 			if q.onlyPrimary {
 				slice, err := q.index.getPrimariesList(p.readTr, q)
@@ -179,6 +329,7 @@ func (q *Query) execute() *PromiseSlice {
 			slice := Slice{}
 			for _, needed := range values {
 				v, err := needed.fetch()
+				q.stats.fetch()
 				if err != nil {
 					return p.done(&slice)
 				}
@@ -187,28 +338,13 @@ func (q *Query) execute() *PromiseSlice {
 			return p.done(&slice)
 		}
 
-		var sub subspace.Subspace
-		sub = q.object.primary
-		if q.primary != nil {
-
-			sub = sub.Sub(q.primary...)
+		r, ok := resumeRange(q.primaryRange(), q.resume, q.reverse)
+		if !ok {
+			return p.done(&Slice{})
 		}
-		start, end := sub.FDBRangeKeys()
-		if q.from != nil {
-			if q.reverse {
-				end = sub.Pack(q.from)
-			} else {
-				start = sub.Pack(q.from)
-			}
-		}
-		if q.to != nil {
-			if q.reverse {
-				start = sub.Pack(q.to)
-			} else {
-				end = sub.Pack(q.to)
-			}
+		if q.fields != nil {
+			return q.executeFields(p, r)
 		}
-		r := fdb.KeyRange{Begin: start, End: end}
 
 		limit := q.object.getKeyLimit(q.limit)
 		if q.next.started {
@@ -223,7 +359,7 @@ func (q *Query) execute() *PromiseSlice {
 
 		elem := valueRaw{}
 		slice := Slice{}
-		var lastTuple tuple.Tuple
+		var lastTuple, returnedTuple tuple.Tuple
 		rowsNum := 0
 
 		kvList, err := rangeResult.GetSliceWithError()
@@ -231,6 +367,7 @@ func (q *Query) execute() *PromiseSlice {
 			return p.fail(err)
 		}
 		for _, kv := range kvList {
+			q.stats.read(kv)
 
 			//iterator := rangeResult.Iterator()
 			//for iterator.Advance() {
@@ -256,6 +393,7 @@ func (q *Query) execute() *PromiseSlice {
 				value.fromRaw(elem)
 				value.fromKeyTuple(lastTuple)
 				slice.Append(&value)
+				returnedTuple = lastTuple
 				// push to items here
 				//res = append(res, elem)
 				elem = valueRaw{}
@@ -282,6 +420,15 @@ func (q *Query) execute() *PromiseSlice {
 			value.fromRaw(elem)
 			value.fromKeyTuple(lastTuple)
 			slice.Append(&value)
+			returnedTuple = lastTuple
+		}
+		if limit != 0 && len(kvList) >= limit && returnedTuple != nil {
+			if reflect.DeepEqual(returnedTuple, lastTuple) {
+				// last object could be cut by the limit, next page will start from it
+				q.next.cursor = q.object.resumeKey(lastTuple, !q.reverse)
+			} else {
+				q.next.cursor = q.object.resumeKey(returnedTuple, q.reverse)
+			}
 		}
 
 		if !reflect.DeepEqual(q.from, lastTuple) {
@@ -296,6 +443,34 @@ func (q *Query) execute() *PromiseSlice {
 	return p
 }
 
+// executeFields scans primary range within one range read keeping only keys of selected fields
+func (q *Query) executeFields(p *PromiseSlice, r fdb.KeyRange) Chain {
+	scanner := q.object.scanPrimary(p.readTr, r, q.reverse)
+	scanner.stats = q.stats
+	selected := q.object.selection(q.fields)
+	slice := Slice{}
+	var lastTuple tuple.Tuple
+	for value := scanner.next(); value != nil; value = scanner.next() {
+		if q.limit != 0 && slice.Len() == q.limit {
+			// next object exists, so the next page is not empty
+			q.next.cursor = q.object.resumeKey(lastTuple, q.reverse)
+			break
+		}
+		lastTuple = scanner.current
+		value.selectFields(q.fields, selected)
+		slice.Append(value)
+	}
+	if scanner.err != nil {
+		return p.fail(scanner.err)
+	}
+	if lastTuple != nil && !reflect.DeepEqual(q.from, lastTuple) {
+		q.next.from = lastTuple
+	} else {
+		q.next.from = nil
+	}
+	return p.done(&slice)
+}
+
 // Next sets from identifier from nextFrom; return true if more data could be fetched
 func (q *Query) Next() bool {
 	if q.next.started {
@@ -304,6 +479,11 @@ func (q *Query) Next() bool {
 			q.next.from = nil
 			return true
 		}
+		if q.next.resume != nil {
+			q.resume = q.next.resume
+			q.next.resume = nil
+			return true
+		}
 		return false
 	}
 	q.next.started = true // prevent endless circle if no queries presented
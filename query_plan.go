@@ -0,0 +1,546 @@
+package stored
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// maxPlanRanges limits number of ranges one index scan could be split to (In conditions)
+const maxPlanRanges = 100
+
+// scanChunk is max number of keys of the driving scan read within one transaction, unless the query
+// is bound to a transaction the scan continues in new read transactions
+const scanChunk = 10000
+
+// DefaultIntersectKeys is the max number of primary keys of one index loaded into memory to intersect
+// it with the driving index, conditions of larger indexes are checked on fetched objects instead
+var DefaultIntersectKeys = 100000
+
+// queryPlan describes how query conditions will be resolved
+type queryPlan struct {
+	scans    []*indexScan // streams of primary keys, intersected; first one is driving the query
+	residual []condition  // conditions checked on fetched values
+	filters  []func(obj interface{}) bool
+}
+
+// indexScan is the list of ranges of one index, primary keys of all ranges are merged
+type indexScan struct {
+	index      *Index
+	ranges     []fdb.KeyRange
+	equal      int         // number of index fields resolved by equality
+	conditions []condition // conditions resolved by the scan
+}
+
+// getPlan returns plan of the query, index selected with Use or primary range of List
+// are scanned as is, otherwise indexes are selected by the planner
+func (q *Query) getPlan() *queryPlan {
+	if q.index != nil {
+		_, r := q.index.getRange(q)
+		return &queryPlan{
+			scans:    []*indexScan{{index: q.index, ranges: []fdb.KeyRange{r}}},
+			residual: q.conditions,
+			filters:  q.filters,
+		}
+	}
+	if q.order != nil {
+		plan := q.orderPlan()
+		if plan != nil {
+			return plan
+		}
+	}
+	if q.primary != nil || q.from != nil || q.to != nil {
+		return &queryPlan{residual: q.conditions, filters: q.filters}
+	}
+	plan := q.plan()
+	plan.filters = q.filters
+	return plan
+}
+
+// plan selects indexes for query conditions
+func (q *Query) plan() *queryPlan {
+	candidates := []*indexScan{}
+	for _, index := range q.object.indexes {
+		scan := q.planIndex(index)
+		if scan != nil {
+			candidates = append(candidates, scan)
+		}
+	}
+	// most selective scans go first
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.equal != b.equal {
+			return a.equal > b.equal
+		}
+		if len(a.conditions) != len(b.conditions) {
+			return len(a.conditions) > len(b.conditions)
+		}
+		if len(a.ranges) != len(b.ranges) {
+			return len(a.ranges) < len(b.ranges)
+		}
+		return a.index.Name < b.index.Name
+	})
+
+	plan := queryPlan{}
+	resolved := map[int]bool{}
+	for _, scan := range candidates {
+		useful := false
+		for _, cond := range scan.conditions {
+			for k := range q.conditions {
+				if !resolved[k] && q.conditions[k].equal(&cond) {
+					resolved[k] = true
+					useful = true
+				}
+			}
+		}
+		if useful {
+			plan.scans = append(plan.scans, scan)
+		}
+	}
+	for k, cond := range q.conditions {
+		if !resolved[k] {
+			plan.residual = append(plan.residual, cond)
+		}
+	}
+	return &plan
+}
+
+// findCondition return first query condition for the field with one of passed operators
+func (q *Query) findCondition(field *Field, ops ...Operator) *condition {
+	for k := range q.conditions {
+		if q.conditions[k].field != field {
+			continue
+		}
+		for _, op := range ops {
+			if q.conditions[k].op == op {
+				return &q.conditions[k]
+			}
+		}
+	}
+	return nil
+}
+
+// planIndex builds index scan if index could resolve part of query conditions
+func (q *Query) planIndex(index *Index) *indexScan {
+	if index.search || index.Geo != 0 || index.handle != nil || index.checkHandler != nil || len(index.fields) == 0 {
+		return nil
+	}
+	// partial index contains only objects matching its conditions
+	for k := range index.conditions {
+		implied := false
+		for n := range q.conditions {
+			if q.conditions[n].equal(&index.conditions[k]) {
+				implied = true
+				break
+			}
+		}
+		if !implied {
+			return nil
+		}
+	}
+
+	scan := indexScan{index: index}
+	prefixes := []tuple.Tuple{{}}
+	var lower, upper *condition
+	for _, field := range index.fields {
+		cond := q.findCondition(field, Eq, In)
+		if cond == nil {
+			lower = q.findCondition(field, Gt, Gte)
+			upper = q.findCondition(field, Lt, Lte)
+			if lower != nil {
+				scan.conditions = append(scan.conditions, *lower)
+			}
+			if upper != nil {
+				scan.conditions = append(scan.conditions, *upper)
+			}
+			break
+		}
+		values := cond.values()
+		if len(prefixes)*len(values) > maxPlanRanges {
+			break
+		}
+		next := []tuple.Tuple{}
+		for _, prefix := range prefixes {
+			for _, value := range values {
+				if index.optional && field.isEmpty(value) { // empty values are not indexed
+					return nil
+				}
+				if index.Unique && field.nullable() && field.isNull(value) { // null values are not unique indexed
+					return nil
+				}
+				key := append(tuple.Tuple{}, prefix...)
+				next = append(next, append(key, field.tupleElement(value)))
+			}
+		}
+		prefixes = next
+		scan.equal++
+		scan.conditions = append(scan.conditions, *cond)
+	}
+	if len(scan.conditions) == 0 {
+		return nil
+	}
+	if index.optional && scan.equal == 0 { // range could contain empty values
+		return nil
+	}
+
+	for _, prefix := range prefixes {
+		scan.ranges = append(scan.ranges, scan.getRange(prefix, lower, upper))
+	}
+	sort.Slice(scan.ranges, func(i, j int) bool {
+		return bytes.Compare(scan.ranges[i].Begin.FDBKey(), scan.ranges[j].Begin.FDBKey()) < 0
+	})
+	return &scan
+}
+
+// getRange returns range of keys starting with prefix, limited by range conditions of next field
+func (s *indexScan) getRange(prefix tuple.Tuple, lower, upper *condition) fdb.KeyRange {
+	begin := s.index.dir.Pack(prefix)
+	end := append(s.index.dir.Pack(prefix), 0xff)
+	if lower != nil {
+		bound := append(append(tuple.Tuple{}, prefix...), lower.field.tupleElement(lower.value))
+		begin = s.index.dir.Pack(bound)
+		if lower.op == Gt {
+			begin = append(begin, 0xff)
+		}
+	}
+	if upper != nil {
+		if lower == nil && upper.field.nullable() { // null values are ordered first
+			begin = append(s.index.dir.Pack(append(append(tuple.Tuple{}, prefix...), nil)), 0xff)
+		}
+		bound := append(append(tuple.Tuple{}, prefix...), upper.field.tupleElement(upper.value))
+		end = s.index.dir.Pack(bound)
+		if upper.op == Lte {
+			end = append(end, 0xff)
+		}
+	}
+	return fdb.KeyRange{Begin: begin, End: end}
+}
+
+// primary extracts primary tuple from index row
+func (s *indexScan) primary(kv fdb.KeyValue) (tuple.Tuple, error) {
+	if s.index.Unique {
+		return tuple.Unpack(kv.Value)
+	}
+	fullTuple, err := s.index.dir.Unpack(kv.Key)
+	if err != nil {
+		return nil, err
+	}
+	primaryLen := len(s.index.object.primaryFields)
+	if len(fullTuple)-primaryLen < 0 {
+		return nil, errors.New("invalid data: key too short")
+	}
+	return fullTuple[len(fullTuple)-primaryLen:], nil
+}
+
+// primarySet fetches primary keys of the scan, ok is false if there are more than limit of them
+func (s *indexScan) primarySet(tr fdb.ReadTransaction, limit int) (res map[string]bool, ok bool, err error) {
+	res = map[string]bool{}
+	read := 0
+	for _, r := range s.ranges {
+		rows, err := tr.GetRange(r, fdb.RangeOptions{Mode: fdb.StreamingModeWantAll, Limit: limit - read + 1}).GetSliceWithError()
+		if err != nil {
+			return nil, false, err
+		}
+		read += len(rows)
+		if read > limit {
+			return nil, false, nil
+		}
+		for _, kv := range rows {
+			primaryTuple, err := s.primary(kv)
+			if err != nil {
+				return nil, false, err
+			}
+			res[string(primaryTuple.Pack())] = true
+		}
+	}
+	return res, true, nil
+}
+
+// intersect loads primary keys of the scans intersected with the driving one. Scans with more than
+// DefaultIntersectKeys keys are dropped from the plan and their conditions are checked on fetched objects
+func (plan *queryPlan) intersect(tr fdb.ReadTransaction, stats *QueryStats) (*queryPlan, []map[string]bool, error) {
+	res := *plan
+	res.scans = []*indexScan{plan.scans[0]}
+	res.residual = append([]condition{}, plan.residual...)
+	sets := []map[string]bool{}
+	for _, scan := range plan.scans[1:] {
+		set, ok, err := scan.primarySet(tr, DefaultIntersectKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			stats.skip()
+			res.residual = append(res.residual, scan.conditions...)
+			continue
+		}
+		res.scans = append(res.scans, scan)
+		sets = append(sets, set)
+	}
+	return &res, sets, nil
+}
+
+// matchResidual checks fetched value with conditions not resolved by indexes and filters
+func (plan *queryPlan) matchResidual(value *Value) bool {
+	if len(plan.residual) == 0 && len(plan.filters) == 0 {
+		return true
+	}
+	obj := value.Interface()
+	input := structAny(obj)
+	for k := range plan.residual {
+		if !plan.residual[k].match(input) {
+			return false
+		}
+	}
+	for _, filter := range plan.filters {
+		if !filter(obj) {
+			return false
+		}
+	}
+	return true
+}
+
+// executePlan resolves the query using selected indexes, checking residual conditions
+func (q *Query) executePlan(p *PromiseSlice, plan *queryPlan) Chain {
+	slice := Slice{}
+	q.next.resume = nil
+	err := q.scanChunks(&p.Promise, plan, q.limit, func(value *Value, resume fdb.Key) error {
+		slice.Append(value)
+		if q.limit != 0 && slice.Len() >= q.limit {
+			q.next.resume = resume
+			q.next.cursor = resume
+		}
+		return nil
+	})
+	if err != nil {
+		return p.fail(err)
+	}
+	return p.done(&slice)
+}
+
+// scanned is the object passed by scanPlan with the key to continue right after it
+type scanned struct {
+	value  *Value
+	resume fdb.Key
+}
+
+// scanChunks passes up to limit objects matching the plan to the callback, 0 means all objects.
+// The plan is scanned in chunks of scanChunk keys, unless the promise is bound to a transaction
+// every chunk after the first one is read in a new read transaction and intersected indexes are
+// loaded again. Objects of the chunk are passed once its transaction succeeds
+func (q *Query) scanChunks(p *Promise, plan *queryPlan, limit int, fn func(value *Value, resume fdb.Key) error) error {
+	scan := *q
+	rows := []scanned{}
+	collect := func(tr fdb.ReadTransaction) (fdb.Key, error) {
+		rows = rows[:0]
+		return scan.scanPlan(tr, plan, scanChunk, func(value *Value, resume fdb.Key) (bool, error) {
+			rows = append(rows, scanned{value: value, resume: resume})
+			return limit == 0 || len(rows) < limit, nil
+		})
+	}
+	tr := p.readTr
+	for {
+		var next fdb.Key
+		var err error
+		if tr != nil {
+			next, err = collect(tr)
+		} else {
+			_, err = p.db.ReadTransact(func(readTr fdb.ReadTransaction) (interface{}, error) {
+				var err error
+				next, err = collect(readTr.Snapshot())
+				return nil, err
+			})
+		}
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			err = fn(row.value, row.resume)
+			if err != nil {
+				return err
+			}
+		}
+		if limit != 0 {
+			limit -= len(rows)
+			if limit <= 0 {
+				return nil
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		scan.resume = next
+		if p.owned {
+			tr = nil
+		}
+	}
+}
+
+// scanPlan passes objects matching the plan to the callback in the order of the scan, callback
+// receives the key to continue the scan right after the object and returns false to stop the scan.
+// After chunk keys are read the scan stops returning the key to continue from, 0 means no limit
+func (q *Query) scanPlan(tr fdb.ReadTransaction, plan *queryPlan, chunk int, fn func(value *Value, resume fdb.Key) (bool, error)) (fdb.Key, error) {
+	if len(plan.scans) == 0 {
+		return q.scanFiltered(tr, plan, chunk, fn)
+	}
+	plan, sets, err := plan.intersect(tr, q.stats)
+	if err != nil {
+		return nil, err
+	}
+	driving := plan.scans[0]
+
+	ranges := append([]fdb.KeyRange{}, driving.ranges...)
+	if q.reverse {
+		for i, j := 0, len(ranges)-1; i < j; i, j = i+1, j-1 {
+			ranges[i], ranges[j] = ranges[j], ranges[i]
+		}
+	}
+
+	type candidate struct {
+		key    fdb.Key
+		needed *needObject
+	}
+	batch := []candidate{}
+	// flush fetches batch of candidates, returns false if the scan is stopped
+	flush := func() (bool, error) {
+		for _, c := range batch {
+			value, err := c.needed.fetch()
+			q.stats.fetch()
+			if err == ErrNotFound { // index is outdated
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			if !plan.matchResidual(value) {
+				q.stats.filter()
+				continue
+			}
+			next, err := fn(value, c.key)
+			if err != nil || !next {
+				return false, err
+			}
+		}
+		batch = batch[:0]
+		return true, nil
+	}
+	processed := 0
+	var resume fdb.Key // last key of the driving scan
+	for _, r := range ranges {
+		r, ok := resumeRange(r, q.resume, q.reverse)
+		if !ok {
+			continue
+		}
+		iterator := tr.GetRange(r, fdb.RangeOptions{
+			Mode:    fdb.StreamingModeIterator,
+			Reverse: q.reverse,
+		}).Iterator()
+		for iterator.Advance() {
+			if chunk != 0 && processed >= chunk {
+				next, err := flush()
+				if err != nil || !next {
+					return nil, err
+				}
+				return resume, nil
+			}
+			kv, err := iterator.Get()
+			if err != nil {
+				return nil, err
+			}
+			q.stats.read(kv)
+			processed++
+			resume = kv.Key
+			primaryTuple, err := driving.primary(kv)
+			if err != nil {
+				return nil, err
+			}
+			packed := string(primaryTuple.Pack())
+			intersected := true
+			for _, set := range sets {
+				if !set[packed] {
+					intersected = false
+					break
+				}
+			}
+			if !intersected {
+				continue
+			}
+			c := candidate{key: kv.Key}
+			if len(plan.residual) == 0 && len(plan.filters) == 0 {
+				c.needed = q.need(tr, primaryTuple)
+			} else { // residual checks need whole object
+				c.needed = q.object.need(tr, q.object.sub(primaryTuple))
+			}
+			batch = append(batch, c)
+			if len(batch) >= q.batchSize() {
+				next, err := flush()
+				if err != nil || !next {
+					return nil, err
+				}
+			}
+		}
+	}
+	_, err = flush()
+	return nil, err
+}
+
+// resumeRange trims index range to continue right after the resume key, returns false
+// if whole range was already scanned
+func resumeRange(r fdb.KeyRange, resume fdb.Key, reverse bool) (fdb.KeyRange, bool) {
+	if resume == nil {
+		return r, true
+	}
+	if reverse {
+		if bytes.Compare(r.Begin.FDBKey(), resume) >= 0 {
+			return r, false
+		}
+		if bytes.Compare(r.End.FDBKey(), resume) > 0 {
+			r.End = resume
+		}
+		return r, true
+	}
+	if bytes.Compare(r.End.FDBKey(), resume) <= 0 {
+		return r, false
+	}
+	if bytes.Compare(r.Begin.FDBKey(), resume) < 0 {
+		r.Begin = append(append(fdb.Key{}, resume...), 0x00)
+	}
+	return r, true
+}
+
+// scanFiltered scans primary subspace checking conditions of each object
+func (q *Query) scanFiltered(tr fdb.ReadTransaction, plan *queryPlan, chunk int, fn func(value *Value, resume fdb.Key) (bool, error)) (fdb.Key, error) {
+	r, ok := resumeRange(q.primaryRange(), q.resume, q.reverse)
+	if !ok {
+		return nil, nil
+	}
+	scanner := q.object.scanPrimary(tr, r, q.reverse)
+	scanner.stats = q.stats
+	processed := 0
+	for value := scanner.next(); value != nil; value = scanner.next() {
+		resume := q.object.resumeKey(scanner.current, q.reverse)
+		processed++
+		if !plan.matchResidual(value) {
+			q.stats.filter()
+		} else {
+			next, err := fn(value, resume)
+			if err != nil || !next {
+				return nil, err
+			}
+		}
+		if chunk != 0 && processed >= chunk {
+			return resume, scanner.err
+		}
+	}
+	return nil, scanner.err
+}
+
+// batchSize is number of objects fetched in parallel while resolving the query
+func (q *Query) batchSize() int {
+	if q.limit > 0 && q.limit < 100 {
+		return q.limit
+	}
+	return 100
+}
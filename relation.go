@@ -345,18 +345,40 @@ func (r *Relation) getHostsOrClients(objOrID interface{}, from interface{}, host
 		if from != nil {
 			start = key.Pack(obj.getPrimaryTuple(from)) // add the last key fetched
 		}
-		iterator := p.readTr.GetRange(fdb.KeyRange{Begin: start, End: end}, fdb.RangeOptions{
-			Limit:   p.limit,
+		scope := "relation:clients"
+		if hosts {
+			scope = "relation:hosts"
+		}
+		bounds := fdb.KeyRange{Begin: start, End: end}
+		keyRange, ok, err := p.resumeRange(scope, bounds)
+		if err != nil {
+			return p.fail(err)
+		}
+		if !ok {
+			keyRange.Begin = keyRange.End
+		}
+		limit := p.limit
+		if limit != 0 {
+			limit++ // extra row shows if the cursor is needed
+		}
+		iterator := p.readTr.GetRange(keyRange, fdb.RangeOptions{
+			Limit:   limit,
 			Reverse: p.reverse,
 		}).Iterator()
 		indexData := [][]byte{}
 		needed := []*needObject{}
+		var lastKey fdb.Key
 		for iterator.Advance() {
 			kv, err := iterator.Get()
 			if err != nil {
 				fmt.Printf("Unable to read next value: %v\n", err)
 				return p.fail(err)
 			}
+			if p.limit != 0 && len(needed) == p.limit {
+				p.cursor = newCursor(scope, bounds, p.reverse, lastKey)
+				break
+			}
+			lastKey = kv.Key
 			keyTuple, err := key.Unpack(kv.Key)
 			if err != nil {
 				fmt.Printf("Unable to unpack index key: %v\n", err)
@@ -532,7 +554,10 @@ func (r *Relation) doUpdateData(hostObj interface{}, clientObj interface{}, call
 				if hostData == nil {
 					return p.fail(ErrNotFound)
 				}
-				hostEditable.setField(r.hostDataField, hostData)
+				err = hostEditable.setField(r.hostDataField, hostData)
+				if err != nil {
+					return p.fail(err)
+				}
 			}
 			if doClient {
 				clientData, err = clientDataGet.Get()
@@ -542,7 +567,10 @@ func (r *Relation) doUpdateData(hostObj interface{}, clientObj interface{}, call
 				if clientData == nil {
 					return p.fail(ErrNotFound)
 				}
-				clientEditable.setField(r.clientDataField, clientData)
+				err = clientEditable.setField(r.clientDataField, clientData)
+				if err != nil {
+					return p.fail(err)
+				}
 			}
 			callback()
 			if doHost {
@@ -0,0 +1,149 @@
+package stored
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+)
+
+// primaryScanner iterates over the primary subspace and groups keys into objects
+type primaryScanner struct {
+	object   *Object
+	iterator *fdb.RangeIterator
+	elem     valueRaw
+	last     tuple.Tuple
+	current  tuple.Tuple // primary of the object returned last
+	stats    *QueryStats
+	err      error
+}
+
+func (o *Object) scanPrimary(tr fdb.ReadTransaction, r fdb.KeyRange, reverse bool) *primaryScanner {
+	return &primaryScanner{
+		object: o,
+		iterator: tr.GetRange(r, fdb.RangeOptions{
+			Mode:    fdb.StreamingModeIterator,
+			Reverse: reverse,
+		}).Iterator(),
+		elem: valueRaw{},
+	}
+}
+
+// flush returns collected object and starts the new one
+func (s *primaryScanner) flush() *Value {
+	value := Value{
+		object: s.object,
+	}
+	value.fromRaw(s.elem)
+	value.fromKeyTuple(s.last)
+	s.current = s.last
+	s.elem = valueRaw{}
+	s.last = nil
+	return &value
+}
+
+// next returns next object of the range, nil if range is over or error happened
+func (s *primaryScanner) next() *Value {
+	keyLen := len(s.object.primaryFields)
+	for s.iterator.Advance() {
+		kv, err := s.iterator.Get()
+		if err != nil {
+			s.err = err
+			return nil
+		}
+		s.stats.read(kv)
+		fullTuple, err := s.object.primary.Unpack(kv.Key)
+		if err != nil {
+			s.err = err
+			return nil
+		}
+		if len(fullTuple) < keyLen {
+			s.err = ErrDataCorrupt
+			return nil
+		}
+		primaryTuple := fullTuple[:keyLen]
+		var ready *Value
+		if s.last != nil && !reflect.DeepEqual(primaryTuple, s.last) {
+			ready = s.flush()
+		}
+		fieldsKey := fullTuple[keyLen:]
+		if len(fieldsKey) > 1 {
+			s.object.panic("nested fields not yet supported")
+		}
+		if len(fieldsKey) == 1 {
+			keyName, ok := fieldsKey[0].(string)
+			if !ok {
+				s.object.panic("invalid key, not string")
+			}
+			s.elem[keyName] = kv.Value
+		}
+		s.last = primaryTuple
+		if ready != nil {
+			return ready
+		}
+	}
+	if s.last != nil {
+		return s.flush()
+	}
+	return nil
+}
+
+// keyScanner iterates over objects of the primary range returning only primary keys, keys of the same
+// object are skipped without decoding
+type keyScanner struct {
+	object   *Object
+	iterator *fdb.RangeIterator
+	last     []byte // packed primary of the object returned last
+	stats    *QueryStats
+	err      error
+}
+
+func (o *Object) scanKeys(tr fdb.ReadTransaction, r fdb.KeyRange, reverse bool) *keyScanner {
+	return &keyScanner{
+		object: o,
+		iterator: tr.GetRange(r, fdb.RangeOptions{
+			Mode:    fdb.StreamingModeWantAll,
+			Reverse: reverse,
+		}).Iterator(),
+	}
+}
+
+// next returns primary of the next object, nil if range is over or error happened
+func (s *keyScanner) next() tuple.Tuple {
+	keyLen := len(s.object.primaryFields)
+	for s.iterator.Advance() {
+		kv, err := s.iterator.Get()
+		if err != nil {
+			s.err = err
+			return nil
+		}
+		s.stats.read(kv)
+		// packed tuples are prefix free, so keys of the same object share packed primary
+		if s.last != nil && bytes.HasPrefix(kv.Key, s.last) {
+			continue
+		}
+		fullTuple, err := s.object.primary.Unpack(kv.Key)
+		if err != nil {
+			s.err = err
+			return nil
+		}
+		if len(fullTuple) < keyLen {
+			s.err = ErrDataCorrupt
+			return nil
+		}
+		primaryTuple := fullTuple[:keyLen]
+		s.last = s.object.primary.Pack(primaryTuple)
+		return primaryTuple
+	}
+	return nil
+}
+
+// resumeKey returns the range bound which will continue the scan right after the passed object
+func (o *Object) resumeKey(primaryTuple tuple.Tuple, reverse bool) fdb.Key {
+	if reverse {
+		return o.primary.Pack(primaryTuple)
+	}
+	_, end := o.primary.Sub(primaryTuple...).FDBRangeKeys()
+	return end.FDBKey()
+}
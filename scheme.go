@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"time"
 
 	"github.com/apple/foundationdb/bindings/go/src/fdb"
 	"github.com/apple/foundationdb/bindings/go/src/fdb/directory"
@@ -18,16 +20,32 @@ import (
 // note: any large field (> than 100kb should be marked as mutable for the performance)
 
 type schemeFull struct { // stored separately, an key for each version
-	versions map[uint64]schemeVersion `json:"versions"`
-	latest   uint64                   `json:"latest"`
-	current  schemeVersion            `json:"-"`
+	versions map[uint64]schemeVersion
+	latest   uint64
+	current  schemeVersion
 }
 
 type schemeVersion struct {
-	PrimaryFields []schemeField `json:"primary"`   // Fields stored inside primary part of key
-	PackedFields  []schemeField `json:"packed"`    // Fields stored at one-key packed body
-	MutableFields []schemeField `json:"mutable"`   // Fields stored as separate keys (mutable keys)
-	Created       int64         `json:"timestamp"` // Time the scheme was created
+	PrimaryFields []schemeField `json:"primary"`         // Fields stored inside primary part of key
+	PackedFields  []schemeField `json:"packed"`          // Fields stored at one-key packed body
+	MutableFields []schemeField `json:"mutable"`         // Fields stored as separate keys (mutable keys)
+	Indexes       []schemeIndex `json:"indexes"`         // Indexes declared for the object
+	Codec         string        `json:"codec,omitempty"` // Codec of packed body, msgpack if empty
+	Created       int64         `json:"timestamp"`       // Time the scheme was created
+}
+
+// schemeIndex describes index declaration, including conditions of partial indexes
+type schemeIndex struct {
+	Name       string            `json:"name"`
+	Unique     bool              `json:"unique,omitempty"`
+	Optional   bool              `json:"optional,omitempty"`
+	Conditions []schemeCondition `json:"where,omitempty"`
+}
+
+type schemeCondition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
 }
 
 // schemeField is needed to match data in diferent position of the value with fields of object
@@ -66,7 +84,15 @@ func (sf *schemeFull) load(ob *ObjectBuilder, dir directory.DirectorySubspace, t
 			fmt.Println("scheme corrupted", err)
 			ob.panic("scheme corrupted")
 		}
-		version := tuple[0].(uint64)
+		var version uint64
+		switch v := tuple[0].(type) {
+		case int64:
+			version = uint64(v)
+		case uint64:
+			version = v
+		default:
+			ob.panic("scheme corrupted")
+		}
 		sf.versions[version] = sch
 	}
 	sf.setLatest()
@@ -74,14 +100,13 @@ func (sf *schemeFull) load(ob *ObjectBuilder, dir directory.DirectorySubspace, t
 }
 
 func (sf *schemeFull) setLatest() *schemeVersion {
-	latestTime := int64(0)
 	latestVer := uint64(0)
-	for ver, scheme := range sf.versions {
-		if scheme.Created > latestTime {
+	for ver := range sf.versions {
+		if ver > latestVer {
 			latestVer = ver
-			latestTime = scheme.Created
 		}
 	}
+	sf.latest = latestVer
 	if latestVer != 0 {
 		v := sf.versions[latestVer]
 		return &v
@@ -89,16 +114,69 @@ func (sf *schemeFull) setLatest() *schemeVersion {
 	return nil
 }
 
+// save writes current scheme as new version if it differs from the latest one
+func (sf *schemeFull) save(ob *ObjectBuilder) error {
+	latest := sf.setLatest()
+	if latest != nil && !sf.compare(&sf.current, latest) {
+		return nil
+	}
+	o := ob.object
+	data, err := json.Marshal(sf.current)
+	if err != nil {
+		return err
+	}
+	sub := o.miscDir.Sub("scheme")
+	res, err := o.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		// version is taken from the db, other instance could store the scheme first
+		start, end := sub.FDBRangeKeys()
+		rows, err := tr.GetRange(fdb.KeyRange{Begin: start, End: end}, fdb.RangeOptions{
+			Limit:   1,
+			Reverse: true,
+		}).GetSliceWithError()
+		if err != nil {
+			return nil, err
+		}
+		version := uint64(1)
+		if len(rows) > 0 {
+			key, err := sub.Unpack(rows[0].Key)
+			if err != nil {
+				return nil, err
+			}
+			if last, ok := key[0].(int64); ok {
+				version = uint64(last) + 1
+			}
+		}
+		tr.Set(sub.Pack(tuple.Tuple{version}), data)
+		return version, nil
+	})
+	if err != nil {
+		return err
+	}
+	version := res.(uint64)
+	sf.versions[version] = sf.current
+	sf.latest = version
+	return nil
+}
+
 func (sf *schemeFull) buildCurrent(ob *ObjectBuilder) {
 	sf.current = schemeVersion{
 		PrimaryFields: []schemeField{},
 		PackedFields:  []schemeField{},
 		MutableFields: []schemeField{},
+		Indexes:       []schemeIndex{},
+		Created:       time.Now().Unix(),
+	}
+	if !ob.object.defaultCodec() {
+		sf.current.Codec = ob.object.codec.Name()
 	}
 	for _, field := range ob.object.primaryFields {
 		sf.current.PrimaryFields = append(sf.current.PrimaryFields, sf.current.wrapField(field))
 	}
-	for _, field := range ob.object.getFields() {
+	fields := ob.object.getFields()
+	sort.Slice(fields, func(i, j int) bool { // keep the order stable to compare versions
+		return fields[i].Num < fields[j].Num
+	})
+	for _, field := range fields {
 		if field.primary {
 			continue
 		}
@@ -108,6 +186,12 @@ func (sf *schemeFull) buildCurrent(ob *ObjectBuilder) {
 			sf.current.PackedFields = append(sf.current.PackedFields, sf.current.wrapField(field))
 		}
 	}
+	for _, index := range ob.object.indexes {
+		sf.current.Indexes = append(sf.current.Indexes, sf.current.wrapIndex(index))
+	}
+	sort.Slice(sf.current.Indexes, func(i, j int) bool {
+		return sf.current.Indexes[i].Name < sf.current.Indexes[j].Name
+	})
 }
 
 // compare returns true if new version should be stored
@@ -145,9 +229,29 @@ func (sf *schemeFull) compare(new *schemeVersion, old *schemeVersion) bool {
 			return true
 		}
 	}
+	if new.Codec != old.Codec {
+		return true
+	}
+	// values of conditions are compared in the stored form
+	newIndexes, _ := json.Marshal(new.Indexes)
+	oldIndexes, _ := json.Marshal(old.Indexes)
+	if string(newIndexes) != string(oldIndexes) {
+		return true
+	}
 	return false
 }
 
+// codecs resolves codecs of scheme versions, versions stored with default codec are skipped
+func (sf *schemeFull) codecs() map[uint64]Codec {
+	res := map[uint64]Codec{}
+	for version, sch := range sf.versions {
+		if sch.Codec != "" {
+			res[version] = codecByName(sch.Codec)
+		}
+	}
+	return res
+}
+
 func (sv *schemeVersion) wrapField(field *Field) schemeField {
 	return schemeField{
 		Name:       field.Name,
@@ -155,3 +259,19 @@ func (sv *schemeVersion) wrapField(field *Field) schemeField {
 		Type:       field.Type.Type.Name(),
 	}
 }
+
+func (sv *schemeVersion) wrapIndex(index *Index) schemeIndex {
+	res := schemeIndex{
+		Name:     index.Name,
+		Unique:   index.Unique,
+		Optional: index.optional,
+	}
+	for _, cond := range index.conditions {
+		res.Conditions = append(res.Conditions, schemeCondition{
+			Field: cond.field.Name,
+			Op:    cond.op.String(),
+			Value: cond.value,
+		})
+	}
+	return res
+}
@@ -19,19 +19,34 @@ type Struct struct {
 }
 
 // setField sets field value using bytes
-func (s *Struct) setField(field *Field, data []byte) {
+func (s *Struct) setField(field *Field, data []byte) error {
 	objField := s.value.Field(field.Num)
-	if objField.Kind() == reflect.Ptr {
-		if objField.IsNil() {
-			// This code is working in main case
-			t := field.Value.Type().Elem()
-			value := reflect.New(t)
-			objField.Set(value) // creating empty object to fill it below
+	if field.nullable() {
+		value, err := field.decodeNullable(data)
+		if err != nil {
+			return fmt.Errorf("field «%s» of «%s» could not be decoded: %v", field.Name, field.object.name, err)
+		}
+		objField.Set(value)
+		return nil
+	}
 
-			if len(data) == 0 { // no reason to go further id no data passed
-				return
-			}
+	if field.isNative(data) {
+		objField.Set(field.fromNative(data))
+		return nil
+	}
+	if encoder := fieldsEncoder(s.value); encoder != nil && decodeGeneratedField(encoder, field.Name, data) {
+		return nil
+	}
+
+	if field.codec.custom() {
+		value, err := field.ToInterface(data)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			objField.Set(reflect.ValueOf(value))
 		}
+		return nil
 	}
 
 	t := field.Value.Type()
@@ -39,10 +54,11 @@ func (s *Struct) setField(field *Field, data []byte) {
 
 	err := msgpack.Unmarshal(data, objValue.Interface())
 	if err != nil {
-		fmt.Println("Decode to value failed", field.Name, field.object.name, len(data), err)
+		return fmt.Errorf("field «%s» of «%s» could not be decoded: %v", field.Name, field.object.name, err)
 	}
 
 	objField.Set(reflect.Indirect(objValue))
+	return nil
 }
 
 // setFieldAutoIncr sets auto incr field value using bytes
@@ -194,16 +210,19 @@ func (s *Struct) setObject(obj reflect.Value, value interface{}) {
 	}
 }
 
-// Fill will use data inside value object to fill struct
-func (s *Struct) Fill(o *Object, v *Value) {
+// Fill will use data inside value object to fill struct, returns error if packed fields could not be decoded
+func (s *Struct) Fill(o *Object, v *Value) error {
 	if !s.editable {
 		panic("attempt to change readonly struct")
 	}
 
 	for fieldName, binaryValue := range v.raw {
 		field, ok := o.mutableFields[fieldName]
-		if ok {
-			s.setField(field, binaryValue)
+		if ok && v.selected(fieldName) {
+			err := s.setField(field, binaryValue)
+			if err != nil {
+				return err
+			}
 		} else {
 			//o.log("unknown field «" + fieldName + "», skipping")
 			//nothing to worry about
@@ -214,13 +233,17 @@ func (s *Struct) Fill(o *Object, v *Value) {
 		field, ok := o.mutableFields[fieldName]
 		if ok {
 			field.setTupleValue(s.value, interfaceValue)
+		} else if field, ok = o.immutableFields[fieldName]; ok && v.fields != nil {
+			// packed immutable fields are partially decoded, so primary is taken from the key
+			field.setKeyValue(s.value, interfaceValue)
 		}
 	}
 
 	immutableFieldsData, ok := v.raw["*"]
 	if ok {
-		fillObjectImmutableFields(o, s.value, immutableFieldsData)
+		return fillObjectImmutableFields(o, s.value, immutableFieldsData, v.fields)
 	}
+	return nil
 }
 
 // Get return field as interface
@@ -232,9 +255,13 @@ func (s *Struct) Get(field *Field) interface{} {
 // GetImmutableFieldsBytes first combine all immutable fields as
 // map[string]interface{}
 // then pack it via msgpack and return the result
-func (s *Struct) GetImmutableFieldsBytes(fields map[string]*Field) []byte {
+func (s *Struct) GetImmutableFieldsBytes(fields map[string]*Field) ([]byte, error) {
 	if len(fields) == 0 {
-		return nil
+		return nil, nil
+	}
+
+	if encoder := fieldsEncoder(s.value); encoder != nil {
+		return encodeGenerated(encoder, s.value, fields)
 	}
 
 	combinedFields := map[string]interface{}{}
@@ -242,23 +269,30 @@ func (s *Struct) GetImmutableFieldsBytes(fields map[string]*Field) []byte {
 	for fieldName, field := range fields {
 		value := s.value.Field(field.Num)
 
-		combinedFields[fieldName] = value.Interface()
-	}
-
-	packedFields, err := msgpack.Marshal(combinedFields)
-	if err != nil {
-		fmt.Println("GetImmutableFieldsBytes failed:", err)
+		packed, err := field.packValue(value)
+		if err != nil {
+			return nil, err
+		}
+		combinedFields[fieldName] = packed
 	}
 
-	return packedFields
+	return msgpack.Marshal(combinedFields)
 }
 
 // GetMutableFieldBytes return mutable field as byteSlice
 func (s *Struct) GetMutableFieldBytes(field *Field) []byte {
 	//if field.SimpleType()
 	value := s.value.Field(field.Num)
+	if field.atomic() {
+		return field.nativeBytes(value)
+	}
+	if encoder := fieldsEncoder(s.value); encoder != nil {
+		if data, ok := encodeGeneratedField(encoder, field.Name); ok {
+			return data
+		}
+	}
 
-	data, err := msgpack.Marshal(value.Interface())
+	data, err := field.ToBytes(value.Interface())
 	if err != nil {
 		fmt.Println("GetMutableFieldBytes failed:", err)
 	}
@@ -1,11 +1,19 @@
 package stored
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"net/url"
+	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/apple/foundationdb/bindings/go/src/fdb"
+	"github.com/apple/foundationdb/bindings/go/src/fdb/tuple"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 var dbUsernameSearchIndex *IndexSearch
@@ -76,6 +84,86 @@ type extendedUser struct {
 	Extra *extra `stored:"extra"`
 }
 
+type partialUser struct {
+	ID       int    `stored:"id,primary"`
+	Email    string `stored:"email"`
+	Verified bool   `stored:"verified"`
+}
+
+type place struct {
+	ID     int    `stored:"id,primary"`
+	City   string `stored:"city"`
+	Status string `stored:"status"`
+	Score  int    `stored:"score"`
+}
+
+type profile struct {
+	ID     int    `stored:"id,primary"`
+	Name   string `stored:"name"`
+	Bio    string `stored:"bio"`
+	Avatar string `stored:"avatar,mutable"`
+	Visits int    `stored:"visits,mutable"`
+}
+
+// generatedUser has methods in the form cmd/stored generates them
+type generatedUser struct {
+	ID     int64    `stored:"id,primary"`
+	Login  string   `stored:"login"`
+	Rating float64  `stored:"rating,mutable"`
+	Tags   []string `stored:"tags"`
+}
+
+var generatedCalls int
+
+func (g *generatedUser) StoredEncodeField(name string, enc *msgpack.Encoder) (bool, error) {
+	generatedCalls++
+	switch name {
+	case "id":
+		return true, enc.EncodeInt64(g.ID)
+	case "login":
+		return true, enc.EncodeString(g.Login)
+	case "rating":
+		return true, enc.EncodeFloat64(g.Rating)
+	}
+	return false, nil
+}
+
+func (g *generatedUser) StoredDecodeField(name string, dec *msgpack.Decoder) (bool, error) {
+	generatedCalls++
+	switch name {
+	case "id":
+		v, err := dec.DecodeInt64()
+		g.ID = v
+		return true, err
+	case "login":
+		v, err := dec.DecodeString()
+		g.Login = v
+		return true, err
+	case "rating":
+		v, err := dec.DecodeFloat64()
+		g.Rating = v
+		return true, err
+	}
+	return false, nil
+}
+
+// point is encoded by FieldCodec
+type point struct {
+	X, Y int8
+}
+
+func (p point) EncodeStored() ([]byte, error) {
+	return []byte{byte(p.X), byte(p.Y)}, nil
+}
+
+func (p *point) DecodeStored(data []byte) error {
+	if len(data) != 2 {
+		return errors.New("point should be 2 bytes")
+	}
+	p.X, p.Y = int8(data[0]), int8(data[1])
+	return nil
+}
+
 // AssertErrors list of errors
 var AssertErrors = []string{}
 
@@ -1124,68 +1212,1682 @@ func testsSingleField(dir *Directory) error {
 
 }
 
-// TestsRun runs tests for STORED FoundationdDB layer
-func TestsRun(db *Cluster) {
-	dir := db.Directory("tests")
-	smUser := dir.Object("setget", user{})
-	smUserIndex := dir.Object("index", user{})
-	smUserIndex.Index("login")
-	smUserUnique := dir.Object("unique", user{})
-	smUserUnique.Unique("login")
-	userAutoIncrement := dir.Object("increment", userAutoInc{})
-	userMulti := dir.Object("multi", userAutoInc{})
-	n2nUser := dir.Object("n2n_user", userN2N{})
-	n2nUser.AutoIncrement("id")
-	n2nChat := dir.Object("n2n_chat", chatN2N{})
-	n2nChat.AutoIncrement("id")
-	n2nUserChat := n2nUser.N2N(n2nChat, "")
-	n2nUserChat.Counter(true)
+func testsPartialIndex(dir *Directory) error {
+	u := dir.Object("partial_index", partialUser{})
+	u.Unique("email").Where("verified", Eq, true).
+		Index("verified").Where("id", Gt, 1).Where("email", Ne, "")
+	dbUser := u.Done()
+	dbUser.Clear()
 
-	n2nUserChat2 := n2nUser.N2N(n2nChat, "")
-	n2nUserChat2.HostData("n2n")
-	n2nUserChat2.ClientData("n2n")
+	err := dbUser.Set(partialUser{ID: 1, Email: "john@example.com"}).Err()
+	if err != nil {
+		return err
+	}
+	// first user is not verified, so it is not presented in unique index
+	err = dbUser.Set(partialUser{ID: 2, Email: "john@example.com", Verified: true}).Err()
+	if err != nil {
+		return err
+	}
+	got := partialUser{Email: "john@example.com"}
+	err = dbUser.GetBy(&got, "email").Err()
+	if err != nil {
+		return err
+	}
+	if got.ID != 2 {
+		return fmt.Errorf("incorrect user fetched by partial index, id %d instead of 2", got.ID)
+	}
 
-	dbBigUser := dir.Object("big_user", bigUser{})
-	dbBigUser.AutoIncrement("id")
-	dbUsernameSearchIndex = dbBigUser.IndexSearch("username", IndexOption{})
+	err = dbUser.Set(partialUser{ID: 2, Email: "john@example.com"}).Err()
+	if err != nil {
+		return err
+	}
+	got = partialUser{Email: "john@example.com"}
+	err = dbUser.GetBy(&got, "email").Err()
+	if err != ErrNotFound {
+		return fmt.Errorf("unverified user should be removed from index, err: %v", err)
+	}
+	// index with several conditions skips the first user by id
+	unverified := []partialUser{}
+	err = dbUser.Use("verified").List(false).ScanAll(&unverified)
+	if err != nil {
+		return err
+	}
+	if len(unverified) != 1 || unverified[0].ID != 2 {
+		return fmt.Errorf("index with several conditions returned %+v", unverified)
+	}
 
-	dbBigUser.IndexSearch("username", IndexOption{})
+	inconsistent, err := dbUser.VerifyIndex("email")
+	if err != nil {
+		return err
+	}
+	if len(inconsistent) != 0 {
+		return fmt.Errorf("partial index has inconsistent rows %v", inconsistent)
+	}
+	return nil
+}
 
-	dbMessage := dir.Object("message", message{})
-	dbMessage.Primary("chat_id", "id")
-	n2nMessageUser := dbMessage.N2N(n2nUser, "")
+func testsWhere(dir *Directory) error {
+	p := dir.Object("where_place", place{})
+	p.Index("city")
+	p.Index("status")
+	dbPlace := p.Done()
+	dbPlace.Clear()
+
+	places := []place{
+		{ID: 1, City: "Paris", Status: "active", Score: 5},
+		{ID: 2, City: "Paris", Status: "closed", Score: 7},
+		{ID: 3, City: "Paris", Status: "active", Score: 12},
+		{ID: 4, City: "Berlin", Status: "active", Score: 20},
+	}
+	for _, row := range places {
+		err := dbPlace.Set(row).Err()
+		if err != nil {
+			return err
+		}
+	}
 
-	// n2n_self
-	n2nSelfUser := dir.Object("n2nselfuser", user{})
-	n2nSelfUser.AutoIncrement("id")
-	n2nSelfUserUser := n2nSelfUser.N2N(n2nSelfUser, "")
+	res := []place{}
+	err := dbPlace.Where("city", Eq, "Paris").Where("status", Eq, "active").ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 2 {
+		return fmt.Errorf("intersection should return 2 rows, got %d", len(res))
+	}
 
-	//dbExtended := dir.Object("ex_user", extendedUser{})
+	// index too large to intersect is checked on fetched objects
+	intersectKeys := DefaultIntersectKeys
+	DefaultIntersectKeys = 1
+	res = []place{}
+	promise := dbPlace.Where("city", Eq, "Paris").Where("status", Eq, "active").Promise()
+	err = promise.ScanAll(&res)
+	DefaultIntersectKeys = intersectKeys
+	if err != nil {
+		return err
+	}
+	if len(res) != 2 || promise.Stats().Skipped != 1 || promise.Stats().Filtered != 1 {
+		return fmt.Errorf("intersection over the limit should return 2 rows, got %d, stats %+v", len(res), promise.Stats())
+	}
 
-	dir.Clear()
-	assert("Clear", testsClear(dir))
-	start := time.Now()
-	userDB := smUser.Done()
-	assert("SetGet", testsSetGet(userDB))
-	assert("Update", testsUpdate(userDB))
-	assert("Index", testsIndex(smUserIndex.Done()))
-	assert("Unique", testsUnique(smUserUnique.Done()))
-	assert("AutoIncrement", testsAutoIncrement(userAutoIncrement.Done()))
-	assert("MultiGet", testsMultiGet(userMulti.Done()))
-	assert("n2n", testsN2N(n2nUser.Done(), n2nChat.Done(), n2nUserChat))
-	assert("n2n_data", testsN2NData(n2nUser.Done(), n2nChat.Done(), n2nUserChat2))
-	assert("types", testsTypes(dbBigUser.Done()))
-	//asset("incField", testsEditField(dbBigUser))
-	assert("multiPrimary", testsMultiPrimary(dbMessage.Done(), n2nMessageUser, n2nUser.Done()))
+	res = []place{}
+	err = dbPlace.Where("city", In, []string{"Paris", "Berlin"}).Where("score", Gt, 10).ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 2 {
+		return fmt.Errorf("union with residual filter should return 2 rows, got %d", len(res))
+	}
 
-	assert("n2n_self", testsN2NSelf(n2nSelfUser.Done(), n2nSelfUserUser))
+	query := dbPlace.Where("status", Eq, "active").Limit(1)
+	fetched := 0
+	for query.Next() {
+		page := []place{}
+		err = query.ScanAll(&page)
+		if err != nil {
+			return err
+		}
+		fetched += len(page)
+	}
+	if fetched != 3 {
+		return fmt.Errorf("paginated query should return 3 rows, got %d", fetched)
+	}
+	return nil
+}
 
-	assert("counter", testsCounter(dir))
-	assert("n2n_client_counter", testsN2NClientCounter(dir))
+func testsFilter(dir *Directory) error {
+	p := dir.Object("filter_place", place{})
+	p.Index("city")
+	dbPlace := p.Done()
+	dbPlace.Clear()
 
-	assert("geo_index", testsGeoIndex(dir))
+	for id := 1; id <= 10; id++ {
+		row := place{ID: id, City: "Paris", Score: id}
+		if id%2 == 0 {
+			row.City = "Berlin"
+		}
+		err := dbPlace.Set(row).Err()
+		if err != nil {
+			return err
+		}
+	}
 
-	assert("single_field", testsSingleField(dir))
+	even := func(obj interface{}) bool {
+		return obj.(place).Score%2 == 0
+	}
+	query := dbPlace.List().Filter(even).Limit(2)
+	fetched := 0
+	for query.Next() {
+		page := []place{}
+		err := query.ScanAll(&page)
+		if err != nil {
+			return err
+		}
+		for _, row := range page {
+			if row.Score%2 != 0 {
+				return fmt.Errorf("filter returned odd score %d", row.Score)
+			}
+		}
+		fetched += len(page)
+	}
+	if fetched != 5 {
+		return fmt.Errorf("filtered list should return 5 rows, got %d", fetched)
+	}
+
+	res := []place{}
+	err := dbPlace.Use("city").List("Paris").Where("score", Gt, 5).ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 2 {
+		return fmt.Errorf("index scan with condition should return 2 rows, got %d", len(res))
+	}
+	return nil
+}
+
+func testsAggregate(dir *Directory) error {
+	p := dir.Object("aggregate_place", place{})
+	p.Index("city")
+	dbPlace := p.Done()
+	dbPlace.Clear()
+
+	for id := 1; id <= 6; id++ {
+		row := place{ID: id, City: "Paris", Score: id * 10}
+		if id > 4 {
+			row.City = "Berlin"
+		}
+		err := dbPlace.Set(row).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	count, err := dbPlace.ListAll().Count().Int64()
+	if err != nil {
+		return err
+	}
+	if count != 6 {
+		return fmt.Errorf("count should be 6, got %d", count)
+	}
+	// result of the promise is kept once computed
+	promise := dbPlace.ListAll().Max("id")
+	err = promise.Err()
+	if err != nil {
+		return err
+	}
+	err = dbPlace.Set(place{ID: 7, City: "Rome"}).Err()
+	if err != nil {
+		return err
+	}
+	maxID, err := promise.Int64()
+	if err != nil {
+		return err
+	}
+	if maxID != 6 {
+		return fmt.Errorf("aggregation result should be cached, got max id %d", maxID)
+	}
+	err = dbPlace.Delete(7).Err()
+	if err != nil {
+		return err
+	}
+	count, err = dbPlace.Where("city", Eq, "Paris").Count().Int64()
+	if err != nil {
+		return err
+	}
+	if count != 4 {
+		return fmt.Errorf("count of Paris should be 4, got %d", count)
+	}
+	sum, err := dbPlace.Where("city", Eq, "Paris").Sum("score").Int64()
+	if err != nil {
+		return err
+	}
+	if sum != 100 {
+		return fmt.Errorf("sum should be 100, got %d", sum)
+	}
+	var max int
+	err = dbPlace.ListAll().Max("score").Scan(&max)
+	if err != nil {
+		return err
+	}
+	if max != 60 {
+		return fmt.Errorf("max should be 60, got %d", max)
+	}
+	all, err := dbPlace.Where("city", Eq, "Paris").Sum("score").Aggregate()
+	if err != nil {
+		return err
+	}
+	if all.Count != 4 || all.Sum != 100 {
+		return fmt.Errorf("unexpected aggregate of Paris %+v", all)
+	}
+
+	groups, err := dbPlace.ListAll().GroupBy("city").Aggregate("score").Groups()
+	if err != nil {
+		return err
+	}
+	if len(groups) != 2 || groups[0].Key != "Berlin" || groups[0].Count != 2 || groups[0].Avg() != 55 {
+		return fmt.Errorf("unexpected groups %+v", groups)
+	}
+	return nil
+}
+
+func testsCursor(dir *Directory) error {
+	p := dir.Object("cursor_place", place{})
+	p.Index("city")
+	search := p.IndexSearch("city", IndexOption{})
+	dbPlace := p.Done()
+	dbPlace.Clear()
+
+	for id := 1; id <= 5; id++ {
+		err := dbPlace.Set(place{ID: id, City: "Paris"}).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, index := range []string{"", "city"} {
+		fetched := 0
+		cursor := ""
+		for page := 0; page < 5; page++ {
+			query := dbPlace.ListAll().Limit(2)
+			if index != "" {
+				query = dbPlace.Use(index).List("Paris").Limit(2)
+			}
+			if cursor != "" {
+				query.After(cursor)
+			}
+			res := []place{}
+			err := query.ScanAll(&res)
+			if err != nil {
+				return err
+			}
+			fetched += len(res)
+			cursor = query.Cursor()
+			if cursor == "" {
+				break
+			}
+		}
+		if fetched != 5 {
+			return fmt.Errorf("cursor pagination using «%s» should return 5 rows, got %d", index, fetched)
+		}
+	}
+
+	// no cursor if the page is the last one
+	last := dbPlace.Use("city").List("Paris").Limit(5)
+	err := last.ScanAll(&[]place{})
+	if err != nil {
+		return err
+	}
+	if last.Cursor() != "" {
+		return errors.New("cursor should be empty when no rows remain")
+	}
+	found := search.Search("Paris").Limit(5)
+	err = found.ScanAll(&[]place{})
+	if err != nil {
+		return err
+	}
+	if found.Cursor() != "" {
+		return errors.New("search cursor should be empty when no rows remain")
+	}
+
+	query := dbPlace.ListAll().Limit(2)
+	err = query.ScanAll(&[]place{})
+	if err != nil {
+		return err
+	}
+	err = dbPlace.ListAll().Reverse().Limit(2).After(query.Cursor()).ScanAll(&[]place{})
+	if err != ErrCursorInvalid {
+		return fmt.Errorf("cursor of other query should be rejected, got %v", err)
+	}
+	err = dbPlace.ListAll().Limit(2).After(query.Cursor() + "x").ScanAll(&[]place{})
+	if err != ErrCursorInvalid {
+		return fmt.Errorf("modified cursor should be rejected, got %v", err)
+	}
+
+	// conditions are the part of the cursor scope, the scanned range is the same
+	filtered := dbPlace.Where("score", Gte, 0).Limit(2)
+	err = filtered.ScanAll(&[]place{})
+	if err != nil {
+		return err
+	}
+	err = dbPlace.Where("score", Gte, 10).Limit(2).After(filtered.Cursor()).ScanAll(&[]place{})
+	if err != ErrCursorInvalid {
+		return fmt.Errorf("cursor of query with other conditions should be rejected, got %v", err)
+	}
+	return nil
+}
+
+func testsIterator(dir *Directory) error {
+	p := dir.Object("iterator_place", place{})
+	p.Index("city")
+	dbPlace := p.Done()
+	dbPlace.Clear()
+
+	for id := 1; id <= 7; id++ {
+		row := place{ID: id, City: "Paris", Score: id}
+		if id%3 == 0 {
+			row.City = "Berlin"
+		}
+		err := dbPlace.Set(row).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	it := dbPlace.ListAll().Iter().Batch(2).Snapshot()
+	lastID := 0
+	for it.Next() {
+		row := place{}
+		err := it.Scan(&row)
+		if err != nil {
+			return err
+		}
+		if row.ID <= lastID {
+			return fmt.Errorf("iterator returned id %d after %d", row.ID, lastID)
+		}
+		lastID = row.ID
+	}
+	if it.Err() != nil {
+		return it.Err()
+	}
+	if lastID != 7 {
+		return fmt.Errorf("iterator should reach id 7, got %d", lastID)
+	}
+
+	it = dbPlace.Where("city", Eq, "Paris").Limit(4).Iter().Batch(3)
+	fetched := 0
+	for it.Next() {
+		fetched++
+	}
+	if it.Err() != nil {
+		return it.Err()
+	}
+	if fetched != 4 {
+		return fmt.Errorf("iterator with limit should return 4 rows, got %d", fetched)
+	}
+	return nil
+}
+
+func testsParallelScan(dir *Directory) error {
+	dbPlace := dir.Object("parallel_place", place{}).Done()
+	dbPlace.Clear()
+
+	for id := 1; id <= 50; id++ {
+		err := dbPlace.Set(place{ID: id, Score: id}).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	var mux sync.Mutex
+	sum := 0
+	shards, err := dbPlace.ParallelScan(4, func(obj interface{}) error {
+		mux.Lock()
+		sum += obj.(place).Score
+		mux.Unlock()
+		return nil
+	}, ScanOption{Batch: 7})
+	if err != nil {
+		return err
+	}
+	if sum != 1275 {
+		return fmt.Errorf("parallel scan should sum scores to 1275, got %d", sum)
+	}
+	scanned := 0
+	for _, shard := range shards {
+		if !shard.Done {
+			return fmt.Errorf("shard %d is not done", shard.Shard)
+		}
+		scanned += shard.Scanned
+	}
+	if scanned != 50 {
+		return fmt.Errorf("shards should scan 50 objects, got %d", scanned)
+	}
+	return nil
+}
+
+func testsSelect(dir *Directory) error {
+	p := dir.Object("select_profile", profile{})
+	p.Index("name")
+	dbProfile := p.Done()
+	dbProfile.Clear()
+
+	err := dbProfile.Set(profile{ID: 1, Name: "John", Bio: "long text", Avatar: "john.png", Visits: 7}).Err()
+	if err != nil {
+		return err
+	}
+
+	row := profile{ID: 1}
+	err = dbProfile.GetFields(&row, "name", "avatar").Err()
+	if err != nil {
+		return err
+	}
+	if row.Name != "John" || row.Avatar != "john.png" || row.Bio != "" || row.Visits != 0 {
+		return fmt.Errorf("unexpected projection %+v", row)
+	}
+	err = dbProfile.GetFields(&profile{ID: 2}, "name").Err()
+	if err != ErrNotFound {
+		return fmt.Errorf("projection of missing object should return ErrNotFound, got %v", err)
+	}
+
+	for _, query := range []*Query{dbProfile.ListAll(), dbProfile.Use("name").List("John")} {
+		res := []profile{}
+		err = query.Select("name", "avatar").ScanAll(&res)
+		if err != nil {
+			return err
+		}
+		if len(res) != 1 || res[0].ID != 1 || res[0].Name != "John" || res[0].Avatar != "john.png" || res[0].Bio != "" {
+			return fmt.Errorf("unexpected query projection %+v", res)
+		}
+	}
+
+	// primary scan with Select reads the range once instead of fetching every object
+	for id := 2; id <= 3; id++ {
+		err = dbProfile.Set(profile{ID: id, Name: "Jane", Avatar: "jane.png", Visits: id}).Err()
+		if err != nil {
+			return err
+		}
+	}
+	promise := dbProfile.ListAll().Select("name").Limit(2).Promise()
+	res := []profile{}
+	err = promise.ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 2 || res[1].Name != "Jane" || res[1].Avatar != "" || res[1].Visits != 0 {
+		return fmt.Errorf("unexpected primary scan projection %+v", res)
+	}
+	if promise.Stats().Fetched != 0 || promise.Stats().KeysRead == 0 {
+		return fmt.Errorf("primary scan with Select should use one range read, stats %+v", promise.Stats())
+	}
+	if promise.Cursor() == "" {
+		return errors.New("primary scan with Select should return cursor when more objects remain")
+	}
+	return nil
+}
+
+func testsOrderBy(dir *Directory) error {
+	p := dir.Object("order_place", place{})
+	p.Index("city", "score")
+	dbPlace := p.Done()
+	dbPlace.Clear()
+
+	places := []place{
+		{ID: 1, City: "Paris", Status: "b", Score: 30},
+		{ID: 2, City: "Paris", Status: "d", Score: 10},
+		{ID: 3, City: "Berlin", Status: "a", Score: 50},
+		{ID: 4, City: "Paris", Status: "c", Score: 20},
+	}
+	for _, row := range places {
+		err := dbPlace.Set(row).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	res := []place{}
+	err := dbPlace.Where("city", Eq, "Paris").OrderBy("score", true).ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 3 || res[0].ID != 1 || res[1].ID != 4 || res[2].ID != 2 {
+		return fmt.Errorf("unexpected order using index %+v", res)
+	}
+
+	res = []place{}
+	err = dbPlace.ListAll().OrderBy("status", false).Limit(2).ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 2 || res[0].ID != 3 || res[1].ID != 1 {
+		return fmt.Errorf("unexpected top of in memory sort %+v", res)
+	}
+
+	err = dbPlace.ListAll().OrderBy("status", false).SortMemory(100).ScanAll(&[]place{})
+	if err != ErrSortMemory {
+		return fmt.Errorf("sort over memory limit should fail, got %v", err)
+	}
+
+	// Reverse inverts the OrderBy direction whatever is called first
+	res = []place{}
+	err = dbPlace.Where("city", Eq, "Paris").Reverse().OrderBy("score", false).ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 3 || res[0].ID != 1 || res[1].ID != 4 || res[2].ID != 2 {
+		return fmt.Errorf("reversed order using index %+v", res)
+	}
+	res = []place{}
+	err = dbPlace.ListAll().Reverse().OrderBy("status", false).Limit(2).ScanAll(&res)
+	if err != nil {
+		return err
+	}
+	if len(res) != 2 || res[0].ID != 2 || res[1].ID != 4 {
+		return fmt.Errorf("reversed in memory sort %+v", res)
+	}
+
+	type rated struct {
+		ID   int64 `stored:"id,primary"`
+		Rank *int  `stored:"rank"`
+	}
+	dbRated := dir.Object("order_rated", rated{}).Done()
+	uncomparable := false
+	func() {
+		defer func() { uncomparable = recover() != nil }()
+		dbRated.ListAll().OrderBy("rank", false)
+	}()
+	if !uncomparable {
+		return errors.New("OrderBy by nullable field should panic")
+	}
+	return nil
+}
+
+func testsExplain(dir *Directory) error {
+	p := dir.Object("explain_place", place{})
+	p.Index("city")
+	dbPlace := p.Done()
+	dbPlace.Clear()
+
+	for id := 1; id <= 6; id++ {
+		row := place{ID: id, City: "Paris", Score: id}
+		if id > 4 {
+			row.City = "Berlin"
+		}
+		err := dbPlace.Set(row).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	explain, err := dbPlace.Where("city", Eq, "Paris").Where("score", Gt, 2).Explain()
+	if err != nil {
+		return err
+	}
+	if explain.Index != "city" || len(explain.Ranges) != 1 || len(explain.Residual) != 1 {
+		return fmt.Errorf("unexpected plan %+v", explain)
+	}
+	if explain.Stats.KeysRead != 4 || explain.Stats.Fetched != 4 || explain.Stats.Filtered != 2 || explain.Stats.Returned != 2 {
+		return fmt.Errorf("unexpected stats %+v", explain.Stats)
+	}
+
+	promise := dbPlace.ListAll().Limit(3).Promise()
+	err = promise.ScanAll(&[]place{})
+	if err != nil {
+		return err
+	}
+	if promise.Stats() == nil || promise.Stats().Returned != 3 {
+		return fmt.Errorf("unexpected promise stats %+v", promise.Stats())
+	}
+	return nil
+}
+
+func testsUpsert(dir *Directory) error {
+	type usr struct {
+		ID    int    `stored:"id,primary"`
+		Login string `stored:"login"`
+		City  string `stored:"city"`
+		Score int    `stored:"score"`
+	}
+	u := dir.Object("upsert_user", usr{})
+	u.AutoIncrement("id")
+	u.Unique("login")
+	cityCount := u.Counter("city")
+	dbUser := u.Done()
+	dbUser.Clear()
+
+	merge := func(stored, input interface{}) error {
+		old := stored.(*usr)
+		old.Score += input.(*usr).Score
+		old.City = input.(*usr).City
+		return nil
+	}
+
+	row := usr{Login: "john", City: "LA", Score: 1}
+	inserted, err := dbUser.Upsert(&row, merge).Bool()
+	if err != nil {
+		return err
+	}
+	if !inserted || row.ID == 0 {
+		return fmt.Errorf("object should be inserted with generated id, got %+v", row)
+	}
+
+	next := usr{ID: row.ID, City: "SF", Score: 2}
+	inserted, err = dbUser.Upsert(&next, merge).Bool()
+	if err != nil {
+		return err
+	}
+	if inserted || next.Score != 3 || next.Login != "john" {
+		return fmt.Errorf("object should be merged, got %+v", next)
+	}
+
+	byLogin := usr{Login: "john"}
+	err = dbUser.GetBy(&byLogin, "login").Err()
+	if err != nil {
+		return err
+	}
+	if byLogin.ID != row.ID || byLogin.Score != 3 {
+		return fmt.Errorf("unique index returned %+v", byLogin)
+	}
+	count, err := cityCount.Get(usr{City: "LA"}).Int64()
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return fmt.Errorf("counter of previous city is %d instead of 0", count)
+	}
+	count, err = cityCount.Get(usr{City: "SF"}).Int64()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return fmt.Errorf("counter of new city is %d instead of 1", count)
+	}
+
+	other := usr{Login: "john", City: "LA"}
+	_, err = dbUser.Upsert(&other, nil).Bool()
+	if err != ErrAlreadyExist {
+		return fmt.Errorf("unique conflict should fail, got %v", err)
+	}
+	return nil
+}
+
+func testsPatch(dir *Directory) error {
+	type article struct {
+		ID     int      `stored:"id,primary"`
+		Title  string   `stored:"title"`
+		Status string   `stored:"status"`
+		Tags   []string `stored:"tags"`
+		Views  int      `stored:"views,mutable"`
+		Rating float64  `stored:"rating,mutable"`
+	}
+	a := dir.Object("patch_article", article{})
+	a.Index("status")
+	statusCount := a.Counter("status")
+	dbArticle := a.Done()
+	dbArticle.Clear()
+
+	err := dbArticle.Set(article{ID: 1, Title: "First", Status: "draft", Views: 1}).Err()
+	if err != nil {
+		return err
+	}
+	err = dbArticle.Patch(1).Inc("views", 2).Inc("rating", 0.5).Append("tags", "go", "fdb").Err()
+	if err != nil {
+		return err
+	}
+	err = dbArticle.Patch(1, map[string]interface{}{"status": "published"}).Err()
+	if err != nil {
+		return err
+	}
+
+	row := article{ID: 1}
+	err = dbArticle.Get(&row).Err()
+	if err != nil {
+		return err
+	}
+	if row.Views != 3 || row.Rating != 0.5 || len(row.Tags) != 2 || row.Title != "First" || row.Status != "published" {
+		return fmt.Errorf("patch produced %+v", row)
+	}
+	rows := []article{}
+	err = dbArticle.Use("status").List("draft").ScanAll(&rows)
+	if err != nil {
+		return err
+	}
+	if len(rows) != 0 {
+		return fmt.Errorf("old index key should be removed, got %d rows", len(rows))
+	}
+	err = dbArticle.Use("status").List("published").ScanAll(&rows)
+	if err != nil {
+		return err
+	}
+	if len(rows) != 1 {
+		return fmt.Errorf("new index key should be written, got %d rows", len(rows))
+	}
+	count, err := statusCount.Get(article{Status: "published"}).Int64()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return fmt.Errorf("counter returned %d instead of 1", count)
+	}
+	err = dbArticle.Patch(2).Set("title", "Missing").Err()
+	if err != ErrNotFound {
+		return fmt.Errorf("patch of missing object should fail with ErrNotFound, got %v", err)
+	}
+	return nil
+}
+
+func testsAtomic(dir *Directory) error {
+	type player struct {
+		ID    int     `stored:"id,primary"`
+		Level int     `stored:"level,mutable,atomic"`
+		Views int64   `stored:"views,mutable,atomic"`
+		Best  uint32  `stored:"best,mutable,atomic"`
+		Flags uint64  `stored:"flags,mutable,atomic"`
+		Score float64 `stored:"score"`
+	}
+	type counter struct {
+		ID   int   `stored:"id,primary"`
+		Hits int64 `stored:"hits,mutable"`
+	}
+	c := dir.Object("atomic_counter", counter{})
+	dbCounter := c.Done()
+	dbCounter.Clear()
+	// value written before atomic option is converted by read-modify-write
+	err := dbCounter.Set(counter{ID: 1, Hits: 10}).Err()
+	if err != nil {
+		return err
+	}
+	atomicCounter := dir.Object("atomic_counter", struct {
+		ID   int   `stored:"id,primary"`
+		Hits int64 `stored:"hits,mutable,atomic"`
+	}{}).Done()
+	for k := 0; k < 2; k++ {
+		err = atomicCounter.IncFieldUnsafe(1, "hits", 1).Err()
+		if err != nil {
+			return err
+		}
+	}
+	err = atomicCounter.IncGetField(1, "hits", 1).Err()
+	if err != nil {
+		return err
+	}
+	hits := counter{ID: 1}
+	err = dbCounter.Get(&hits).Err()
+	if err != nil {
+		return err
+	}
+	if hits.Hits != 13 {
+		return fmt.Errorf("increments of converted field should be kept, got %d", hits.Hits)
+	}
+	err = dbCounter.IncFieldUnsafe(1, "hits", 1).Err()
+	if err != nil {
+		return err
+	}
+	hits = counter{ID: 1}
+	err = dbCounter.Get(&hits).Err()
+	if err != nil {
+		return err
+	}
+	if hits.Hits != 14 {
+		return fmt.Errorf("native value should be incremented without atomic option, got %d", hits.Hits)
+	}
+
+	pl := dir.Object("atomic_player", player{})
+	pl.Index("level")
+	dbPlayer := pl.Done()
+	dbPlayer.Clear()
+
+	err = dbPlayer.Set(player{ID: 1, Level: 1, Views: 10, Best: 5}).Err()
+	if err != nil {
+		return err
+	}
+	var wait sync.WaitGroup
+	for k := 0; k < 5; k++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			err := dbPlayer.Atomic(1).Add("views", 1).Max("best", 7).BitOr("flags", 2).Err()
+			if err != nil {
+				assert("atomic_parallel", err)
+			}
+		}()
+	}
+	wait.Wait()
+	err = dbPlayer.Atomic(1).Add("level", 2).Add("score", 1.5).Min("best", 6).Err()
+	if err != nil {
+		return err
+	}
+
+	row := player{ID: 1}
+	err = dbPlayer.Get(&row).Err()
+	if err != nil {
+		return err
+	}
+	if row.Views != 15 || row.Best != 6 || row.Flags != 2 || row.Level != 3 || row.Score != 1.5 {
+		return fmt.Errorf("atomic operations produced %+v", row)
+	}
+	rows := []player{}
+	err = dbPlayer.Use("level").List(3).ScanAll(&rows)
+	if err != nil {
+		return err
+	}
+	if len(rows) != 1 {
+		return fmt.Errorf("index should be updated, got %d rows", len(rows))
+	}
+	err = dbPlayer.Atomic(2).Add("views", 1).Err()
+	if err != ErrNotFound {
+		return fmt.Errorf("atomic operation of missing object should fail with ErrNotFound, got %v", err)
+	}
+	return nil
+}
+
+func testsCompareAndSet(dir *Directory) error {
+	type order struct {
+		ID     int    `stored:"id,primary"`
+		Status string `stored:"status"`
+		Paid   int    `stored:"paid,mutable"`
+	}
+	ob := dir.Object("cas_order", order{})
+	ob.Index("status")
+	dbOrder := ob.Done()
+	dbOrder.Clear()
+
+	err := dbOrder.Set(order{ID: 1, Status: "pending"}).Err()
+	if err != nil {
+		return err
+	}
+	err = dbOrder.CompareAndSet(1, "status", "pending", "paid").Err()
+	if err != nil {
+		return err
+	}
+	err = dbOrder.CompareAndSet(1, "status", "pending", "paid").Err()
+	precondition, ok := err.(*PreconditionError)
+	if !ok || precondition.Field != "status" || precondition.Actual != "paid" {
+		return fmt.Errorf("second transition should fail with precondition error, got %v", err)
+	}
+	err = dbOrder.SetIf(1, map[string]interface{}{"status": "paid"}, map[string]interface{}{"status": "shipped", "paid": 100}).Err()
+	if err != nil {
+		return err
+	}
+	err = dbOrder.Patch(1).If("paid", Gt, 100).Set("status", "refunded").Err()
+	if _, ok := err.(*PreconditionError); !ok {
+		return fmt.Errorf("patch with failed condition should return precondition error, got %v", err)
+	}
+
+	rows := []order{}
+	err = dbOrder.Use("status").List("shipped").ScanAll(&rows)
+	if err != nil {
+		return err
+	}
+	if len(rows) != 1 || rows[0].Paid != 100 {
+		return fmt.Errorf("index should contain shipped order, got %+v", rows)
+	}
+	return nil
+}
+
+func testsBulk(dir *Directory) error {
+	type item struct {
+		ID    int64  `stored:"id,primary"`
+		Login string `stored:"login"`
+	}
+	it := dir.Object("bulk_item", item{})
+	it.AutoIncrement("id")
+	it.Unique("login")
+	dbItem := it.Done()
+	dbItem.Clear()
+
+	items := make([]item, 250)
+	for k := range items {
+		items[k].Login = "user" + strconv.Itoa(k)
+	}
+	items[200].Login = "user10" // duplicate of unique login
+	failed, err := dbItem.BulkAdd(items, BulkOption{MaxKeys: 40, Workers: 3})
+	if err != nil {
+		return err
+	}
+	if len(failed) != 1 || failed[0].Index != 200 || failed[0].Err != ErrAlreadyExist {
+		return fmt.Errorf("only duplicate should fail, got %v", failed)
+	}
+	if items[0].ID == 0 || items[249].ID != items[0].ID+249 {
+		return fmt.Errorf("ids should be reserved sequentially, got %d and %d", items[0].ID, items[249].ID)
+	}
+	count, err := dbItem.ListAll().Count().Int64()
+	if err != nil {
+		return err
+	}
+	if count != 249 {
+		return fmt.Errorf("bulk add wrote %d objects instead of 249", count)
+	}
+
+	ids := []int64{}
+	for k := 0; k < 100; k++ {
+		ids = append(ids, items[k].ID)
+	}
+	ids = append(ids, items[200].ID) // was not added
+	failed, err = dbItem.BulkDelete(ids, BulkOption{MaxKeys: 30})
+	if err != nil {
+		return err
+	}
+	if len(failed) != 1 || failed[0].Index != 100 || failed[0].Err != ErrNotFound {
+		return fmt.Errorf("only missing object should fail, got %v", failed)
+	}
+	count, err = dbItem.ListAll().Count().Int64()
+	if err != nil {
+		return err
+	}
+	if count != 149 {
+		return fmt.Errorf("bulk delete left %d objects instead of 149", count)
+	}
+	_, err = dbItem.BulkDelete(items[0].ID)
+	if err == nil {
+		return errors.New("bulk delete of not a slice should fail")
+	}
+	return nil
+}
+
+func testsExport(dir *Directory) error {
+	type member struct {
+		ID    int64  `stored:"id,primary"`
+		Login string `stored:"login"`
+		Score int    `stored:"score,mutable"`
+	}
+	type room struct {
+		ID   int64  `stored:"id,primary"`
+		Name string `stored:"name"`
+	}
+	declare := func(d *Directory) (*Object, *Object, *Relation) {
+		m := d.Object("member", member{})
+		m.AutoIncrement("id")
+		m.Unique("login")
+		r := d.Object("room", room{})
+		rel := m.N2N(r, "")
+		rel.Counter(true)
+		dbMember, dbRoom := m.Done(), r.Done()
+		dbMember.Clear()
+		dbRoom.Clear()
+		return dbMember, dbRoom, rel
+	}
+	srcMember, srcRoom, srcRel := declare(dir.Cluster.Directory("tests_export_src"))
+	dst := dir.Cluster.Directory("tests_export_dst")
+	dstMember, _, dstRel := declare(dst)
+
+	members := []member{{Login: "john", Score: 5}, {Login: "sam"}, {Login: "nick"}}
+	for k := range members {
+		err := srcMember.Add(&members[k]).Err()
+		if err != nil {
+			return err
+		}
+	}
+	err := srcRoom.Set(room{ID: 1, Name: "general"}).Err()
+	if err != nil {
+		return err
+	}
+	for _, m := range members[:2] {
+		err = srcRel.Set(m, int64(1)).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, format := range []ExportFormat{FormatJSON, FormatMsgpack} {
+		buf := bytes.Buffer{}
+		err = dir.Cluster.Directory("tests_export_src").ExportWith(&buf, ExportOption{Format: format, Snapshot: true}, srcMember, srcRoom)
+		if err != nil {
+			return err
+		}
+		err = dst.Import(&buf, ExportOption{Format: format, Batch: 2})
+		if err != nil {
+			return err
+		}
+	}
+
+	john := member{Login: "john"}
+	err = dstMember.GetBy(&john, "login").Err()
+	if err != nil {
+		return err
+	}
+	if john.ID != members[0].ID || john.Score != 5 {
+		return fmt.Errorf("imported object is %+v", john)
+	}
+	count, err := dstRel.GetHostsCount(int64(1)).Int64()
+	if err != nil {
+		return err
+	}
+	if count != 2 {
+		return fmt.Errorf("relation counter is %d instead of 2 after importing twice", count)
+	}
+	next := member{Login: "new"}
+	err = dstMember.Add(&next).Err()
+	if err != nil {
+		return err
+	}
+	if next.ID <= members[2].ID {
+		return fmt.Errorf("autoincrement should continue after imported ids, got %d", next.ID)
+	}
+
+	// rows exported before the type of the field changed are not imported
+	type changedMember struct {
+		ID    int64  `stored:"id,primary"`
+		Login string `stored:"login"`
+		Score string `stored:"score,mutable"`
+	}
+	changed := dir.Cluster.Directory("tests_export_changed")
+	dbChanged := changed.Object("member", changedMember{}).Done()
+	dbChanged.Clear()
+	buf := bytes.Buffer{}
+	err = dir.Cluster.Directory("tests_export_src").Export(&buf, srcMember)
+	if err != nil {
+		return err
+	}
+	err = changed.Import(&buf)
+	if !errors.Is(err, ErrSchemeMismatch) {
+		return fmt.Errorf("import into changed scheme should fail with ErrSchemeMismatch, got %v", err)
+	}
+	count, err = dbChanged.ListAll().Count().Int64()
+	if err != nil {
+		return err
+	}
+	if count != 0 {
+		return fmt.Errorf("import into changed scheme wrote %d rows", count)
+	}
+	return nil
+}
+
+func testsGenerated(dir *Directory) error {
+	dbGenerated := dir.Object("generated_user", generatedUser{}).Done()
+	dbGenerated.Clear()
+	generatedCalls = 0
+	input := generatedUser{ID: 7, Login: "gen", Rating: 4.5, Tags: []string{"a", "b"}}
+	err := dbGenerated.Add(&input).Err()
+	if err != nil {
+		return err
+	}
+	if generatedCalls == 0 {
+		return errors.New("generated encoder was not used")
+	}
+	generatedCalls = 0
+	fetched := generatedUser{ID: 7}
+	err = dbGenerated.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if generatedCalls == 0 {
+		return errors.New("generated decoder was not used")
+	}
+	if fetched.Login != "gen" || fetched.Rating != 4.5 || len(fetched.Tags) != 2 || fetched.Tags[1] != "b" {
+		return fmt.Errorf("generated fields decoded incorrectly: %+v", fetched)
+	}
+	return nil
+}
+
+func testsTimeFields(dir *Directory) error {
+	type event struct {
+		ID      int64         `stored:"id,primary"`
+		At      time.Time     `stored:"at"`
+		Seen    time.Time     `stored:"seen,mutable"`
+		Timeout time.Duration `stored:"timeout"`
+		Ping    time.Duration `stored:"ping,mutable"`
+		Place   point         `stored:"place"`
+		Link    url.URL       `stored:"link"`
+	}
+	e := dir.Object("time_event", event{})
+	e.Index("at")
+	e.Index("place")
+	dbEvent := e.Done()
+	dbEvent.Clear()
+
+	start := time.Unix(1600000000, 500)
+	for k := 1; k <= 3; k++ {
+		row := event{
+			ID:      int64(k),
+			At:      start.Add(time.Duration(k) * time.Hour),
+			Seen:    start,
+			Timeout: time.Duration(k) * time.Second,
+			Ping:    time.Millisecond,
+			Place:   point{X: int8(k), Y: -1},
+			Link:    url.URL{Scheme: "https", Host: "example.com", Path: "/" + strconv.Itoa(k)},
+		}
+		err := dbEvent.Add(&row).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	fetched := event{ID: 2}
+	err := dbEvent.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if !fetched.At.Equal(start.Add(2*time.Hour)) || !fetched.Seen.Equal(start) || fetched.Timeout != 2*time.Second ||
+		fetched.Ping != time.Millisecond || fetched.Place != (point{X: 2, Y: -1}) || fetched.Link.Path != "/2" {
+		return fmt.Errorf("fields decoded incorrectly: %+v", fetched)
+	}
+
+	later := []event{}
+	err = dbEvent.Use("at").From(start.Add(2 * time.Hour)).ScanAll(&later)
+	if err != nil {
+		return err
+	}
+	if len(later) != 2 || later[0].ID != 2 || later[1].ID != 3 {
+		return fmt.Errorf("time index should return events 2 and 3, got %d", len(later))
+	}
+
+	byPlace := []event{}
+	err = dbEvent.Use("place").List(point{X: 3, Y: -1}).ScanAll(&byPlace)
+	if err != nil {
+		return err
+	}
+	if len(byPlace) != 1 || byPlace[0].ID != 3 {
+		return fmt.Errorf("codec index should return event 3, got %d", len(byPlace))
+	}
+
+	// value the codec could not decode fails the read instead of leaving zero value
+	type marker struct {
+		ID    int64 `stored:"id,primary"`
+		Place point `stored:"place,mutable"`
+	}
+	dbMarker := dir.Object("time_marker", marker{}).Done()
+	dbMarker.Clear()
+	err = dbMarker.Add(&marker{ID: 1, Place: point{X: 1, Y: 1}}).Err()
+	if err != nil {
+		return err
+	}
+	_, err = dbMarker.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(dbMarker.sub(tuple.Tuple{int64(1)}).Pack(tuple.Tuple{"place"}), []byte{0xc4, 0x01, 0x01})
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	if dbMarker.Get(&marker{ID: 1}).Err() == nil {
+		return errors.New("Get of field the codec could not decode should fail")
+	}
+	return nil
+}
+
+func testsNullable(dir *Directory) error {
+	type profile struct {
+		ID    int64           `stored:"id,primary"`
+		Age   *int            `stored:"age,mutable"`
+		Email Null[string]    `stored:"email"`
+		Born  Null[time.Time] `stored:"born"`
+		Rank  Null[int64]     `stored:"rank,mutable"`
+		Owner *string         `stored:"owner"`
+	}
+	p := dir.Object("nullable_profile", profile{})
+	p.Unique("email")
+	p.Index("rank")
+	dbProfile := p.Done()
+	dbProfile.Clear()
+
+	zero := 0
+	owner := "root"
+	born := time.Unix(1500000000, 0)
+	rows := []profile{
+		{ID: 1, Age: &zero, Email: NullOf(""), Born: NullOf(born), Rank: NullOf(int64(0)), Owner: &owner},
+		{ID: 2},
+		{ID: 3},
+	}
+	for k := range rows {
+		err := dbProfile.Add(&rows[k]).Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	fetched := profile{ID: 1}
+	err := dbProfile.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Age == nil || *fetched.Age != 0 || !fetched.Email.Valid || !fetched.Born.Valid ||
+		!fetched.Born.Value.Equal(born) || !fetched.Rank.Valid || fetched.Owner == nil || *fetched.Owner != owner {
+		return fmt.Errorf("zero values should differ from null: %+v", fetched)
+	}
+	fetched = profile{ID: 2}
+	err = dbProfile.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Age != nil || fetched.Email.Valid || fetched.Born.Valid || fetched.Rank.Valid || fetched.Owner != nil {
+		return fmt.Errorf("null values should stay null: %+v", fetched)
+	}
+
+	duplicate := profile{ID: 4, Email: NullOf("")}
+	err = dbProfile.Add(&duplicate).Err()
+	if err != ErrAlreadyExist {
+		return fmt.Errorf("unique index should reject duplicate value, got %v", err)
+	}
+
+	ranked := []profile{}
+	err = dbProfile.Use("rank").List(int64(0)).ScanAll(&ranked)
+	if err != nil {
+		return err
+	}
+	if len(ranked) != 1 || ranked[0].ID != 1 {
+		return fmt.Errorf("index should distinguish zero from null, got %d rows", len(ranked))
+	}
+
+	rows[0].Rank = Null[int64]{}
+	rows[0].Age = nil
+	err = dbProfile.Set(&rows[0]).Err()
+	if err != nil {
+		return err
+	}
+	unset := []profile{}
+	err = dbProfile.Where("rank", Eq, nil).ScanAll(&unset)
+	if err != nil {
+		return err
+	}
+	if len(unset) != 3 {
+		return fmt.Errorf("all profiles should have unset rank, got %d", len(unset))
+	}
+
+	// null values should not be unique indexed
+	emailIndex := dbProfile.indexes["email"]
+	inconsistent, err := dbProfile.VerifyIndex("email")
+	if err != nil {
+		return err
+	}
+	if len(inconsistent) != 0 {
+		return fmt.Errorf("unique index has inconsistent rows %v", inconsistent)
+	}
+	_, err = dbProfile.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(emailIndex.dir.Pack(tuple.Tuple{nil}), tuple.Tuple{int64(2)}.Pack())
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	inconsistent, err = dbProfile.VerifyIndex("email")
+	if err != nil {
+		return err
+	}
+	if len(inconsistent) != 1 || inconsistent[0][0] != int64(2) {
+		return fmt.Errorf("indexed null value should be reported, got %v", inconsistent)
+	}
+	return nil
+}
+
+func testsCodec(dir *Directory) error {
+	type note struct {
+		ID    int64       `stored:"id,primary"`
+		Text  string      `stored:"text"`
+		Tags  []string    `stored:"tags"`
+		At    time.Time   `stored:"at"`
+		Place Null[point] `stored:"place"`
+		Views int64       `stored:"views,mutable"`
+	}
+	n := dir.Object("codec_note", note{})
+	n.Codec(JSONCodec)
+	dbNote := n.Done()
+	dbNote.Clear()
+
+	at := time.Unix(1600000000, 0)
+	row := note{ID: 1, Text: "json", Tags: []string{"a", "b"}, At: at, Place: NullOf(point{X: 1, Y: 2}), Views: 3}
+	err := dbNote.Add(&row).Err()
+	if err != nil {
+		return err
+	}
+	err = dbNote.IncFieldUnsafe(&row, "views", 1).Err()
+	if err != nil {
+		return err
+	}
+
+	// the same object migrated back to msgpack should read rows written by JSON codec
+	migrated := dir.Object("codec_note", note{}).Done()
+	fetched := note{ID: 1}
+	err = migrated.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Text != "json" || len(fetched.Tags) != 2 || !fetched.At.Equal(at) || fetched.Place != row.Place || fetched.Views != 4 {
+		return fmt.Errorf("row written by JSON codec decoded incorrectly: %+v", fetched)
+	}
+	fetched.Text = "msgpack"
+	err = migrated.Set(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	fetched = note{ID: 1}
+	err = dbNote.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Text != "msgpack" {
+		return fmt.Errorf("row written by msgpack codec decoded incorrectly: %+v", fetched)
+	}
+
+	// packed fields which could not be decoded fail the read
+	_, err = dbNote.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(dbNote.sub(tuple.Tuple{int64(1)}).Pack(tuple.Tuple{"*"}), []byte{0xc1, 0x01, '{'})
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	if dbNote.Get(&note{ID: 1}).Err() == nil {
+		return errors.New("Get of corrupted row should fail")
+	}
+	list := []note{}
+	if dbNote.ListAll().ScanAll(&list) == nil {
+		return errors.New("List of corrupted row should fail")
+	}
+
+	// mutable field which could not be decoded fails the read as well
+	err = dbNote.Add(&note{ID: 2, Text: "mutable"}).Err()
+	if err != nil {
+		return err
+	}
+	_, err = dbNote.db.Transact(func(tr fdb.Transaction) (interface{}, error) {
+		tr.Set(dbNote.sub(tuple.Tuple{int64(2)}).Pack(tuple.Tuple{"views"}), []byte{0xc1})
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+	if dbNote.Get(&note{ID: 2}).Err() == nil {
+		return errors.New("Get of row with corrupted mutable field should fail")
+	}
+	return nil
+}
+
+func testsValidation(dir *Directory) error {
+	type account struct {
+		ID     int64  `stored:"id,primary"`
+		Email  string `stored:"email,required,regexp=^[^@ ]+@[^@ ]+$"`
+		Age    int    `stored:"age,min=18,max=150"`
+		Login  string `stored:"login,maxlen=8"`
+		Status string `stored:"status,default=new"`
+		Admin  bool   `stored:"admin"`
+	}
+	// options after regexp would become part of the expression
+	misplaced := false
+	func() {
+		defer func() { misplaced = recover() != nil }()
+		type misplacedTag struct {
+			Email string `stored:"email,regexp=^[a-z]+$,mutable"`
+		}
+		field := Field{Type: reflect.TypeOf(misplacedTag{}).Field(0)}
+		field.ParseTag()
+	}()
+	if !misplaced {
+		return errors.New("option after regexp should panic")
+	}
+
+	a := dir.Object("validation_account", account{})
+	a.Validate(func(obj interface{}) error {
+		if acc := obj.(*account); acc.Admin && acc.Age < 21 {
+			return errors.New("admin should be at least 21")
+		}
+		return nil
+	})
+	dbAccount := a.Done()
+	dbAccount.Clear()
+
+	invalid := account{ID: 1, Email: "nobody", Age: 10, Login: "toolonglogin"}
+	err := dbAccount.Add(&invalid).Err()
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		return fmt.Errorf("invalid object should not be added, got %v", err)
+	}
+	if len(validationErr.Fields) != 3 || validationErr.Fields[0].Field != "email" || validationErr.Fields[1].Rule != "min" {
+		return fmt.Errorf("validation error should list offending fields: %v", err)
+	}
+
+	acc := account{ID: 1, Email: "john@example.com", Age: 20, Login: "john"}
+	err = dbAccount.Set(&acc).Err()
+	if err != nil {
+		return err
+	}
+	if acc.Status != "new" {
+		return fmt.Errorf("default value should be set, got %q", acc.Status)
+	}
+
+	err = dbAccount.Update(&acc, func() error {
+		acc.Admin = true
+		return nil
+	}).Err()
+	if _, ok := err.(*ValidationError); !ok {
+		return fmt.Errorf("object validator should fail the update, got %v", err)
+	}
+	fetched := account{ID: 1}
+	err = dbAccount.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Admin || fetched.Status != "new" {
+		return fmt.Errorf("invalid update should not be written: %+v", fetched)
+	}
+
+	// patches are validated as the whole object
+	err = dbAccount.Patch(int64(1)).Set("age", 10).Err()
+	if _, ok := err.(*ValidationError); !ok {
+		return fmt.Errorf("invalid patch should fail, got %v", err)
+	}
+	err = dbAccount.Atomic(int64(1)).Add("age", -5).Err()
+	if _, ok := err.(*ValidationError); !ok {
+		return fmt.Errorf("invalid atomic change should fail, got %v", err)
+	}
+	err = dbAccount.CompareAndSet(int64(1), "email", "john@example.com", "john").Err()
+	if _, ok := err.(*ValidationError); !ok {
+		return fmt.Errorf("invalid compare and set should fail, got %v", err)
+	}
+	err = dbAccount.Patch(int64(1)).Inc("age", 5).Err()
+	if err != nil {
+		return err
+	}
+
+	// field level methods skip validation
+	fetched.Login = "toolonglogin"
+	err = dbAccount.SetField(&fetched, "login").Err()
+	if err != nil {
+		return err
+	}
+	fetched = account{ID: 1}
+	err = dbAccount.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Age != 25 || fetched.Login != "toolonglogin" {
+		return fmt.Errorf("valid patch and SetField should be written: %+v", fetched)
+	}
+	return nil
+}
+
+func testsHooks(dir *Directory) error {
+	type member struct {
+		ID        int64     `stored:"id,primary"`
+		Email     string    `stored:"email"`
+		Protected bool      `stored:"protected"`
+		UpdatedAt time.Time `stored:"updated_at"`
+	}
+	type memberEvent struct {
+		ID       int64  `stored:"id,primary"`
+		MemberID int64  `stored:"member_id"`
+		Kind     string `stored:"kind"`
+	}
+	e := dir.Object("hooks_event", memberEvent{})
+	e.AutoIncrement("id")
+	dbEvent := e.Done()
+	dbEvent.Clear()
+
+	deleted, chained := 0, 0
+	var dbMember *Object
+	m := dir.Object("hooks_member", member{})
+	m.BeforeWrite(func(tr *Transaction, oldObj, newObj interface{}) (PromiseAny, error) {
+		mem := newObj.(*member)
+		mem.Email = strings.ToLower(strings.TrimSpace(mem.Email))
+		mem.UpdatedAt = time.Now()
+		return nil, nil
+	})
+	m.AfterWrite(func(tr *Transaction, oldObj, newObj interface{}) (PromiseAny, error) {
+		mem := newObj.(*member)
+		if mem.Email == "missing@example.com" {
+			return dbEvent.Get(&memberEvent{ID: -1}), nil
+		}
+		kind := "updated"
+		if oldObj == nil {
+			kind = "created"
+		}
+		return dbEvent.Add(&memberEvent{MemberID: mem.ID, Kind: kind}).After(func() PromiseAny {
+			chained++
+			return dbMember.Get(&member{ID: mem.ID})
+		}), nil
+	})
+	m.BeforeDelete(func(tr *Transaction, oldObj, newObj interface{}) (PromiseAny, error) {
+		if oldObj.(*member).Protected {
+			return nil, errors.New("member is protected")
+		}
+		return nil, nil
+	})
+	m.AfterDelete(func(tr *Transaction, oldObj, newObj interface{}) (PromiseAny, error) {
+		deleted++
+		return nil, nil
+	})
+	dbMember = m.Done()
+	dbMember.Clear()
+
+	err := dbMember.Add(&member{ID: 1, Email: " John@Example.COM "}).Err()
+	if err != nil {
+		return err
+	}
+	err = dbMember.Set(member{ID: 1, Email: "JOHN@example.com", Protected: true}).Err()
+	if err != nil {
+		return err
+	}
+	fetched := member{ID: 1}
+	err = dbMember.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Email != "john@example.com" || fetched.UpdatedAt.IsZero() {
+		return fmt.Errorf("before write hook changes should be written: %+v", fetched)
+	}
+	events := []memberEvent{}
+	err = dbEvent.ListAll().ScanAll(&events)
+	if err != nil {
+		return err
+	}
+	if len(events) != 2 || events[0].Kind != "created" || events[1].Kind != "updated" {
+		return fmt.Errorf("after write hook should add 2 events, got %+v", events)
+	}
+	if chained < 2 {
+		return fmt.Errorf("promise set by After inside the hook should be performed, performed %d times", chained)
+	}
+
+	// failed promise of the hook fails the write
+	err = dbMember.Add(&member{ID: 2, Email: "missing@example.com"}).Err()
+	if err != ErrNotFound {
+		return fmt.Errorf("failed promise of after write hook should fail the write, got %v", err)
+	}
+	err = dbMember.Get(&member{ID: 2}).Err()
+	if err != ErrNotFound {
+		return fmt.Errorf("write with failed hook promise should not be stored, got %v", err)
+	}
+
+	// patch goes through the same hooks
+	err = dbMember.Patch(int64(1)).Set("email", " Jane@Example.COM ").Err()
+	if err != nil {
+		return err
+	}
+	fetched = member{ID: 1}
+	err = dbMember.Get(&fetched).Err()
+	if err != nil {
+		return err
+	}
+	if fetched.Email != "jane@example.com" {
+		return fmt.Errorf("before write hook should be applied to patch: %+v", fetched)
+	}
+	count, err := dbEvent.ListAll().Count().Int64()
+	if err != nil {
+		return err
+	}
+	if count != 3 {
+		return fmt.Errorf("after write hook should be called by patch, got %d events", count)
+	}
+
+	err = dbMember.Delete(int64(1)).Err()
+	if err == nil || err.Error() != "member is protected" {
+		return fmt.Errorf("before delete hook should abort the delete, got %v", err)
+	}
+	err = dbMember.Write(member{ID: 1}).Err()
+	if err != nil {
+		return err
+	}
+	err = dbMember.Delete(int64(1)).Err()
+	if err != nil {
+		return err
+	}
+	if deleted != 1 {
+		return fmt.Errorf("after delete hook should be called once, called %d times", deleted)
+	}
+	return nil
+}
+
+// TestsRun runs tests for STORED FoundationdDB layer
+func TestsRun(db *Cluster) {
+	dir := db.Directory("tests")
+	smUser := dir.Object("setget", user{})
+	smUserIndex := dir.Object("index", user{})
+	smUserIndex.Index("login")
+	smUserUnique := dir.Object("unique", user{})
+	smUserUnique.Unique("login")
+	userAutoIncrement := dir.Object("increment", userAutoInc{})
+	userMulti := dir.Object("multi", userAutoInc{})
+	n2nUser := dir.Object("n2n_user", userN2N{})
+	n2nUser.AutoIncrement("id")
+	n2nChat := dir.Object("n2n_chat", chatN2N{})
+	n2nChat.AutoIncrement("id")
+	n2nUserChat := n2nUser.N2N(n2nChat, "")
+	n2nUserChat.Counter(true)
+
+	n2nUserChat2 := n2nUser.N2N(n2nChat, "")
+	n2nUserChat2.HostData("n2n")
+	n2nUserChat2.ClientData("n2n")
+
+	dbBigUser := dir.Object("big_user", bigUser{})
+	dbBigUser.AutoIncrement("id")
+	dbUsernameSearchIndex = dbBigUser.IndexSearch("username", IndexOption{})
+
+	dbBigUser.IndexSearch("username", IndexOption{})
+
+	dbMessage := dir.Object("message", message{})
+	dbMessage.Primary("chat_id", "id")
+	n2nMessageUser := dbMessage.N2N(n2nUser, "")
+
+	// n2n_self
+	n2nSelfUser := dir.Object("n2nselfuser", user{})
+	n2nSelfUser.AutoIncrement("id")
+	n2nSelfUserUser := n2nSelfUser.N2N(n2nSelfUser, "")
+
+	//dbExtended := dir.Object("ex_user", extendedUser{})
+
+	dir.Clear()
+	assert("Clear", testsClear(dir))
+	start := time.Now()
+	userDB := smUser.Done()
+	assert("SetGet", testsSetGet(userDB))
+	assert("Update", testsUpdate(userDB))
+	assert("Index", testsIndex(smUserIndex.Done()))
+	assert("Unique", testsUnique(smUserUnique.Done()))
+	assert("AutoIncrement", testsAutoIncrement(userAutoIncrement.Done()))
+	assert("MultiGet", testsMultiGet(userMulti.Done()))
+	assert("n2n", testsN2N(n2nUser.Done(), n2nChat.Done(), n2nUserChat))
+	assert("n2n_data", testsN2NData(n2nUser.Done(), n2nChat.Done(), n2nUserChat2))
+	assert("types", testsTypes(dbBigUser.Done()))
+	//asset("incField", testsEditField(dbBigUser))
+	assert("multiPrimary", testsMultiPrimary(dbMessage.Done(), n2nMessageUser, n2nUser.Done()))
+
+	assert("n2n_self", testsN2NSelf(n2nSelfUser.Done(), n2nSelfUserUser))
+
+	assert("counter", testsCounter(dir))
+	assert("n2n_client_counter", testsN2NClientCounter(dir))
+
+	assert("geo_index", testsGeoIndex(dir))
+
+	assert("single_field", testsSingleField(dir))
+
+	assert("partial_index", testsPartialIndex(dir))
+	assert("where", testsWhere(dir))
+	assert("filter", testsFilter(dir))
+	assert("aggregate", testsAggregate(dir))
+	assert("cursor", testsCursor(dir))
+	assert("iterator", testsIterator(dir))
+	assert("parallel_scan", testsParallelScan(dir))
+	assert("select", testsSelect(dir))
+	assert("order_by", testsOrderBy(dir))
+	assert("explain", testsExplain(dir))
+	assert("upsert", testsUpsert(dir))
+	assert("patch", testsPatch(dir))
+	assert("atomic", testsAtomic(dir))
+	assert("compare_and_set", testsCompareAndSet(dir))
+	assert("bulk", testsBulk(dir))
+	assert("export", testsExport(dir))
+	assert("generated", testsGenerated(dir))
+	assert("time fields", testsTimeFields(dir))
+	assert("nullable", testsNullable(dir))
+	assert("codec", testsCodec(dir))
+	assert("validation", testsValidation(dir))
+	assert("hooks", testsHooks(dir))
 
 	assert("search_autocomplete_search", testsAutocompleteSearch(dbBigUser.Done()))
 	assert("update_inc_field_unsafe", testIncFieldUnsafe(dbBigUser.Done()))
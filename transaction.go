@@ -121,6 +121,7 @@ func (t *Transaction) execute() (ret interface{}, err error) {
 				// once error happened at any promise - transaction is failed
 				if promise.err != nil && promise.err != ErrSkip {
 					promise.after = nil // no after in that case
+					promise.queued = nil
 					if task.check {
 						err = promise.err
 						fmt.Println("PROMISE ERERRR", err)
@@ -129,6 +130,15 @@ func (t *Transaction) execute() (ret interface{}, err error) {
 				}
 				next = true
 			} else { // if promise is done we chan check for postponed relative promises
+				// promises of hooks fail the transaction the same way as the promise which enqueued them
+				for _, queued := range promise.queued {
+					hook := queued.self()
+					t.setTr(hook)
+					t.tasks = append(t.tasks, transactionTask{promise: hook, check: task.check})
+					chains = append(chains, hook.chain)
+					next = true
+				}
+				promise.queued = nil
 				if promise.after != nil {
 					after := promise.after().self()
 					promise.after = nil
@@ -24,6 +24,24 @@ var ErrDataCorrupt = errors.New("Data corrupt")
 // ErrAlreadyExist Object with this primary index or one of unique indexes already
 var ErrAlreadyExist = errors.New("This object already exist")
 
+// ErrPrimaryChanged returned when merge callback changed primary key of the object
+var ErrPrimaryChanged = errors.New("Primary key could not be changed")
+
+// ErrNullPrimary returned when nullable primary field of the object is unset
+var ErrNullPrimary = errors.New("Primary key could not be null")
+
+// PreconditionError returned by conditional writes when the stored object does not match the condition
+type PreconditionError struct {
+	Field    string
+	Op       Operator
+	Expected interface{}
+	Actual   interface{}
+}
+
+func (e *PreconditionError) Error() string {
+	return fmt.Sprintf("Precondition failed: field «%s» is %v, expected %s %v", e.Field, e.Actual, e.Op, e.Expected)
+}
+
 // ErrSkip returned in cases when it is necessary to skip operation without cancelling
 // underlying transactions
 var ErrSkip = errors.New("Operation was skipped")
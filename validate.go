@@ -0,0 +1,205 @@
+package stored
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationError returned by Add, Set, Write, Update, Upsert, Patch and Atomic when the object does not match rules of the
+// field tags or validators of the object. Object is not written
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// FieldError describes failed rule, Field is empty for errors returned by object validators
+type FieldError struct {
+	Field   string
+	Rule    string // required, min, max, maxlen, regexp or validate
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	messages := []string{}
+	for _, fieldErr := range e.Fields {
+		if fieldErr.Field == "" {
+			messages = append(messages, fieldErr.Message)
+			continue
+		}
+		messages = append(messages, "field «"+fieldErr.Field+"» "+fieldErr.Message)
+	}
+	return "Validation failed: " + strings.Join(messages, ", ")
+}
+
+// fieldRules are declared by tag options: default=, required, min=, max=, maxlen=, regexp=
+type fieldRules struct {
+	defaultValue reflect.Value
+	required     bool
+	min          *float64
+	max          *float64
+	maxLen       int
+	pattern      *regexp.Regexp
+}
+
+var typeOfDuration = reflect.TypeOf(time.Duration(0))
+
+// setRules parses rule options of the tag according to the field type
+func (f *Field) setRules(options map[string]string) {
+	if len(options) == 0 {
+		return
+	}
+	rules := fieldRules{}
+	base := f
+	if f.nullable() {
+		base = f.elem
+	}
+	for option, value := range options {
+		var err error
+		switch option {
+		case "required":
+			rules.required = true
+		case "default":
+			var parsed reflect.Value
+			parsed, err = base.parseValue(value)
+			if err == nil && f.nullable() {
+				parsed = f.wrap(parsed)
+			}
+			rules.defaultValue = parsed
+		case "min", "max":
+			if !isNumberKind(base.Kind) {
+				f.panic(option + " option requires number field")
+			}
+			var parsed reflect.Value
+			parsed, err = base.parseValue(value)
+			if err == nil {
+				limit := toFloat64(parsed)
+				if option == "min" {
+					rules.min = &limit
+				} else {
+					rules.max = &limit
+				}
+			}
+		case "maxlen":
+			if base.Kind != reflect.String && base.Kind != reflect.Slice && base.Kind != reflect.Map {
+				f.panic("maxlen option requires string, slice or map field")
+			}
+			rules.maxLen, err = strconv.Atoi(value)
+		case "regexp":
+			if base.Kind != reflect.String {
+				f.panic("regexp option requires string field")
+			}
+			rules.pattern, err = regexp.Compile(value)
+		}
+		if err != nil {
+			f.panic("has invalid " + option + " option: " + err.Error())
+		}
+	}
+	f.rules = &rules
+}
+
+// parseValue converts option value of the tag to the field type
+func (f *Field) parseValue(value string) (reflect.Value, error) {
+	res := reflect.New(f.Type.Type).Elem()
+	switch {
+	case f.Type.Type == typeOfDuration:
+		d, err := time.ParseDuration(value)
+		res.SetInt(int64(d))
+		return res, err
+	case f.Type.Type == typeOfTime:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		res.Set(reflect.ValueOf(t))
+		return res, err
+	case isIntKind(f.Kind):
+		n, err := strconv.ParseInt(value, 10, 64)
+		res.SetInt(n)
+		return res, err
+	case isUintKind(f.Kind):
+		n, err := strconv.ParseUint(value, 10, 64)
+		res.SetUint(n)
+		return res, err
+	case f.Kind == reflect.Float32 || f.Kind == reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		res.SetFloat(n)
+		return res, err
+	case f.Kind == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		res.SetBool(b)
+		return res, err
+	case f.Kind == reflect.String:
+		res.SetString(value)
+		return res, nil
+	}
+	return res, fmt.Errorf("values of %s type could not be set by tag", f.Type.Type)
+}
+
+// validate checks the value against rules of the field, rules except required are skipped for null values
+func (f *Field) validate(val interface{}) *FieldError {
+	rules := f.rules
+	if f.isEmpty(val) && rules.required {
+		return &FieldError{Field: f.Name, Rule: "required", Message: "is required"}
+	}
+	value := reflect.ValueOf(val)
+	if f.nullable() {
+		if f.isNull(val) {
+			return nil
+		}
+		value = reflect.ValueOf(f.unwrap(val))
+	}
+	if rules.min != nil && toFloat64(value) < *rules.min {
+		return &FieldError{Field: f.Name, Rule: "min", Message: fmt.Sprintf("should be at least %v", *rules.min)}
+	}
+	if rules.max != nil && toFloat64(value) > *rules.max {
+		return &FieldError{Field: f.Name, Rule: "max", Message: fmt.Sprintf("should be at most %v", *rules.max)}
+	}
+	if rules.maxLen > 0 {
+		length := value.Len()
+		if value.Kind() == reflect.String {
+			length = utf8.RuneCountInString(value.String())
+		}
+		if length > rules.maxLen {
+			return &FieldError{Field: f.Name, Rule: "maxlen", Message: fmt.Sprintf("should be at most %d long", rules.maxLen)}
+		}
+	}
+	if rules.pattern != nil && !rules.pattern.MatchString(value.String()) {
+		return &FieldError{Field: f.Name, Rule: "regexp", Message: "should match " + rules.pattern.String()}
+	}
+	return nil
+}
+
+// prepare sets default values of empty fields and validates the input before write. Input is copied
+// if it could not be changed, primary is already taken from the input so it gets no default
+func (o *Object) prepare(input *Struct) (*Struct, error) {
+	validationErr := ValidationError{}
+	for _, field := range o.ruledFields {
+		if field.rules.defaultValue.IsValid() && !field.primary && field.isEmpty(input.Get(field)) {
+			if !input.value.CanSet() {
+				value := reflect.New(o.reflectType).Elem()
+				value.Set(input.value)
+				input = &Struct{value: value, editable: true}
+			}
+			input.value.Field(field.Num).Set(field.rules.defaultValue)
+		}
+		if fieldErr := field.validate(input.Get(field)); fieldErr != nil {
+			validationErr.Fields = append(validationErr.Fields, *fieldErr)
+		}
+	}
+	for _, validator := range o.validators {
+		err := validator(o.objectPtr(input))
+		if err == nil {
+			continue
+		}
+		if fieldsErr, ok := err.(*ValidationError); ok {
+			validationErr.Fields = append(validationErr.Fields, fieldsErr.Fields...)
+		} else {
+			validationErr.Fields = append(validationErr.Fields, FieldError{Rule: "validate", Message: err.Error()})
+		}
+	}
+	if len(validationErr.Fields) > 0 {
+		return input, &validationErr
+	}
+	return input, nil
+}
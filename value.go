@@ -18,7 +18,8 @@ type Value struct {
 	object  *Object
 	fetch   func()
 	raw     valueRaw
-	decoded valueInterface // decoded overwrites raw (used for primary)
+	decoded valueInterface  // decoded overwrites raw (used for primary)
+	fields  map[string]bool // selected fields, nil if all fields are necessary
 	err     error
 }
 
@@ -44,6 +45,22 @@ func (v *Value) fromRaw(raw valueRaw) {
 	}*/
 }
 
+// selectFields drops keys of not selected fields, the same keys needFields would read
+func (v *Value) selectFields(fields []*Field, selected map[string]bool) {
+	raw := valueRaw{}
+	for _, field := range fields {
+		keyName := field.Name
+		if !field.mutable {
+			keyName = "*"
+		}
+		if data, ok := v.raw[keyName]; ok && !field.primary {
+			raw[keyName] = data
+		}
+	}
+	v.raw = raw
+	v.fields = selected
+}
+
 func (v *Value) fromKeyTuple(keysTuple tuple.Tuple) {
 	v.decoded = valueInterface{}
 	if len(keysTuple) != len(v.object.primaryFields) {
@@ -125,7 +142,10 @@ func (v *Value) Scan(objectPtr interface{}) error {
 	}
 
 	value := structEditable(objectPtr)
-	value.Fill(v.object, v)
+	err := value.Fill(v.object, v)
+	if err != nil {
+		return err
+	}
 	/*object := reflect.ValueOf(objectPtr).Elem()
 	for key, val := range v.data {
 		field, ok := v.object.fields[key]
@@ -156,9 +176,10 @@ func (v *Value) Reflect() (reflect.Value, error) {
 		return value, v.err
 	}
 	value = value.Elem()
+	encoder := fieldsEncoder(value)
 	for key, binaryValue := range v.raw {
 		field, ok := v.object.mutableFields[key]
-		if !ok {
+		if !ok || !v.selected(key) {
 			//fmt.Println("field not found", key, "of object", v.object.name)
 			continue
 		}
@@ -168,18 +189,32 @@ func (v *Value) Reflect() (reflect.Value, error) {
 			continue
 		}
 
-		//fmt.Println("filling interface", binaryValue)
-
-		val := field.ToInterface(binaryValue)
-		//interfaceValue := reflect.ValueOf(val)
+		if field.isNative(binaryValue) {
+			objField.Set(field.fromNative(binaryValue))
+			continue
+		}
+		if encoder != nil && decodeGeneratedField(encoder, key, binaryValue) {
+			continue
+		}
 
-		setMsgPackObjectGround(field, objField, val)
+		val, err := field.ToInterface(binaryValue)
+		if err != nil {
+			return value, err
+		}
+		err = setMsgPackObjectGround(field, objField, val)
+		if err != nil {
+			return value, err
+		}
 		//objField.Set(interfaceValue)
 	}
 
 	for key, interfaceValue := range v.decoded {
 		field, ok := v.object.mutableFields[key]
 		if !ok {
+			if field, ok = v.object.immutableFields[key]; ok && v.fields != nil {
+				// packed immutable fields are partially decoded, so primary is taken from the key
+				field.setKeyValue(value, interfaceValue)
+			}
 			continue
 		}
 
@@ -188,12 +223,20 @@ func (v *Value) Reflect() (reflect.Value, error) {
 
 	immutableFieldsData, ok := v.raw["*"]
 	if ok {
-		fillObjectImmutableFields(v.object, value, immutableFieldsData)
+		err := fillObjectImmutableFields(v.object, value, immutableFieldsData, v.fields)
+		if err != nil {
+			return value, err
+		}
 	}
 
 	return value, nil
 }
 
+// selected checks if field should be filled
+func (v *Value) selected(fieldName string) bool {
+	return v.fields == nil || v.fields[fieldName]
+}
+
 // Err returns an error
 func (v *Value) Err() error {
 	if v.fetch != nil {